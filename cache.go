@@ -0,0 +1,249 @@
+package redisstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ttlGetter is implemented by clients able to read a key along with its TTL
+// in a single round trip, required by the local cache.
+type ttlGetter interface {
+	// GetWithTTL returns the value of key and its remaining TTL, negative if
+	// key does not expire, or ErrNil if key does not exist.
+	GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// pubSubClient is implemented by clients able to publish and subscribe to
+// redis channels, required by SetCacheInvalidation.
+type pubSubClient interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	// Subscribe calls fn with the messages of channel, from another
+	// goroutine, until the returned subscription is closed.
+	Subscribe(ctx context.Context, channel string, fn func(message []byte)) (io.Closer, error)
+}
+
+// localCache is an in-process LRU cache of the data of sessions, by redis
+// key, safe for concurrent use. A zero size disables it.
+type localCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List // most recently used first
+	items map[string]*list.Element
+	gen   uint64 // incremented by removals, see add
+}
+
+// cacheEntry is an element of the list of a localCache.
+type cacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func newLocalCache() *localCache {
+	return &localCache{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// reset empties c and sets its size and TTL.
+func (c *localCache) reset(size int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size, c.ttl = size, ttl
+	c.clear()
+}
+
+// enabled reports whether c keeps any entry, and returns the generation to
+// pass to add.
+func (c *localCache) enabled() (bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size > 0, c.gen
+}
+
+// get returns the data of key unless it expired at now.
+func (c *localCache) get(key string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.data, true
+}
+
+// add keeps data, read at now from redis where it expires after ttl, if
+// nothing was removed from c since the generation gen, when data was read;
+// it could be stale otherwise. Entries never outlive the redis TTL.
+func (c *localCache) add(key string, data []byte, ttl time.Duration, now time.Time, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 || c.gen != gen {
+		return
+	}
+	if ttl < 0 || ttl > c.ttl { // negative if the key doesn't expire
+		ttl = c.ttl
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, data, now.Add(ttl)})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+// remove drops keys from c, or every entry without keys.
+func (c *localCache) remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if len(keys) == 0 {
+		c.clear()
+		return
+	}
+	for _, key := range keys {
+		if e, ok := c.items[key]; ok {
+			c.ll.Remove(e)
+			delete(c.items, key)
+		}
+	}
+}
+
+// clear drops every entry of c, which must be locked.
+func (c *localCache) clear() {
+	c.gen++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// SetLocalCache keeps the data of up to size sessions read from redis in
+// memory for ttl, so sessions loaded again are not read from redis, e.g. by
+// high-traffic endpoints used by the same few sessions. Entries never outlive
+// the TTL of the session in redis, and are dropped when the store saves or
+// deletes the session. Other instances of an application don't see these
+// changes without SetCacheInvalidation, and may serve stale sessions for up
+// to ttl. The cache requires a client with a GetWithTTL method, like the
+// clients of this package, and does not apply to HashMode. Values are still
+// decoded on every load, so sessions never share them. A zero size, the
+// default, disables the cache.
+func (rs *RedisStore) SetLocalCache(size int, ttl time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if ttl <= 0 {
+		size = 0
+	}
+	rs.cache.reset(size, ttl)
+}
+
+// invalidation publishes the changes of sessions to the caches of other
+// instances of an application.
+type invalidation struct {
+	client  pubSubClient
+	channel string
+	id      string // sent with messages, to ignore those of the store itself
+	sub     io.Closer
+}
+
+// SetCacheInvalidation makes the stores of an application drop sessions
+// saved or deleted by one of them from their local cache, through the redis
+// pub/sub channel. Messages lost while a connection is down leave stale
+// entries for up to the TTL of the cache. It requires a client with Publish
+// and Subscribe methods, like the clients of this package. Closing the store
+// unsubscribes; an empty channel, the default, unsubscribes too.
+func (rs *RedisStore) SetCacheInvalidation(channel string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.unsubscribe(); err != nil {
+		return unavailable(err)
+	}
+	if channel == "" {
+		return nil
+	}
+	c, ok := rs.client().(pubSubClient)
+	if !ok {
+		return errors.New("redisstore: client does not support pub/sub")
+	}
+	id, err := randomID(minIDLength).Generate()
+	if err != nil {
+		return err
+	}
+	cache := rs.cache
+	sub, err := c.Subscribe(context.Background(), channel, func(message []byte) {
+		from, key, _ := strings.Cut(string(message), "\n")
+		if from == id {
+			return
+		}
+		if key == "" {
+			cache.remove()
+		} else {
+			cache.remove(key)
+		}
+	})
+	if err != nil {
+		return unavailable(err)
+	}
+	rs.invalidation = &invalidation{c, channel, id, sub}
+	return nil
+}
+
+// unsubscribe stops the cache invalidation, if any.
+func (rs *RedisStore) unsubscribe() error {
+	if rs.invalidation == nil {
+		return nil
+	}
+	err := rs.invalidation.sub.Close()
+	rs.invalidation = nil
+	return err
+}
+
+// get returns the data of key, from the local cache if it has it, or from
+// redis, adding it to the cache.
+func (rs *RedisStore) get(ctx context.Context, key string) ([]byte, error) {
+	if data, ok := rs.cache.get(key, rs.now()); ok {
+		return data, nil
+	}
+	c, ok := rs.client().(ttlGetter)
+	enabled, gen := rs.cache.enabled()
+	if !ok || !enabled {
+		return rs.client().Get(ctx, key)
+	}
+	data, ttl, err := c.GetWithTTL(ctx, key)
+	if err == nil {
+		rs.cache.add(key, data, ttl, rs.now(), gen)
+	}
+	return data, err
+}
+
+// invalidate drops keys from the local cache, or every key without keys, and
+// from the caches of other instances with SetCacheInvalidation. Failures to
+// notify them are only logged, as the changes are already in redis.
+func (rs *RedisStore) invalidate(ctx context.Context, keys ...string) {
+	rs.cache.remove(keys...)
+	inv := rs.invalidation
+	if inv == nil {
+		return
+	}
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+	for _, key := range keys {
+		if err := inv.client.Publish(ctx, inv.channel, []byte(inv.id+"\n"+key)); err != nil {
+			rs.log(ctx, slog.LevelWarn, "redisstore: publishing cache invalidation", "channel", inv.channel, "error", err)
+		}
+	}
+}
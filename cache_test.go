@@ -0,0 +1,168 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSetLocalCache(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetLocalCache(10, time.Minute)
+	clock := newFakeClock(store, mr)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	session.Options.MaxAge = 30
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	req2 := requestWith(res)
+	for i := 0; i < 3; i++ {
+		s, err := store.New(req2, sessionName)
+		if err != nil || s.IsNew || s.Values["key"] != ok {
+			t.Fatalf("expected the session, got %v", err)
+		}
+		s.Values["key"] = "changed" // not shared with later loads
+	}
+	if counts["get"] != 1 {
+		t.Errorf("expected a single GET, got %d", counts["get"])
+	}
+
+	session.Values["key"] = "saved"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.New(req2, sessionName); s.Values["key"] != "saved" || counts["get"] != 2 {
+		t.Errorf("expected the saved session from redis, got %v after %d GETs", s.Values["key"], counts["get"])
+	}
+
+	// cached for a minute, but gone from redis after 30s
+	clock.Advance(31 * time.Second)
+	if s, _ := store.New(req2, sessionName); !s.IsNew {
+		t.Error("expected the cache not to outlive the redis TTL")
+	}
+}
+
+func TestLocalCacheSize(t *testing.T) {
+	c := newLocalCache()
+	c.reset(2, time.Minute)
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		_, gen := c.enabled()
+		c.add(key, []byte(key), -1, now, gen)
+	}
+	if _, ok := c.get("a", now); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if _, ok := c.get("b", now); !ok {
+		t.Error("expected b to be cached")
+	}
+	if _, ok := c.get("b", now.Add(time.Minute)); ok {
+		t.Error("expected b to expire after the cache TTL")
+	}
+
+	_, gen := c.enabled()
+	c.remove("c")
+	c.add("d", []byte("d"), -1, now, gen)
+	if _, ok := c.get("d", now); ok {
+		t.Error("expected data read before a removal not to be cached")
+	}
+}
+
+func TestSetCacheInvalidation(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			a := NewRedisStoreWithClient(c, []byte("secret"))
+			b := NewRedisStoreWithClient(c, []byte("secret"))
+			for _, store := range []*Store{a, b} {
+				store.SetLocalCache(10, time.Minute)
+				if err := store.SetCacheInvalidation("sessions:" + name); err != nil {
+					t.Fatal(err)
+				}
+				defer store.Close()
+			}
+			stale := NewRedisStoreWithClient(c, []byte("secret"))
+			stale.SetLocalCache(10, time.Minute)
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := a.New(req, sessionName)
+			session.Values["key"] = ok
+			res := httptest.NewRecorder()
+			if err := a.Save(req, res, session); err != nil {
+				t.Fatal(err)
+			}
+			req2 := requestWith(res)
+			for _, store := range []*Store{a, b, stale} {
+				if s, _ := store.New(req2, sessionName); s.IsNew {
+					t.Fatal("expected the session to be loaded")
+				}
+			}
+
+			if found, err := b.Delete(session.ID); err != nil || !found {
+				t.Fatalf("expected the session to be deleted, got %v, %v", found, err)
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				s, _ := a.New(req2, sessionName)
+				if s.IsNew {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("expected the delete on another store to drop the cached session")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if s, _ := stale.New(req2, sessionName); s.IsNew {
+				t.Error("expected a store without invalidation to keep its cached session")
+			}
+		})
+	}
+
+	store := NewRedisStoreWithClient(&countingClient{Client: NewGoRedisV9Client(redis.NewClient(&redis.Options{Addr: mr.Addr()}))}, []byte("secret"))
+	if err := store.SetCacheInvalidation("sessions"); err == nil {
+		t.Error("expected an error for a client without pub/sub")
+	}
+}
+
+func benchmarkLocalCache(b *testing.B, size int) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetLocalCache(size, time.Minute)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		b.Fatal(err)
+	}
+	req = requestWith(res)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.New(req, sessionName); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counts["get"])/float64(b.N), "redis-gets/op")
+}
+
+func BenchmarkLoad(b *testing.B)           { benchmarkLocalCache(b, 0) }
+func BenchmarkLoadLocalCache(b *testing.B) { benchmarkLocalCache(b, 100) }
@@ -0,0 +1,955 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	redisv6 "github.com/go-redis/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+// Client is the set of redis commands run by the store. Implement it to
+// back the store with a redis library other than the ones supported by
+// NewGoRedisClient, NewGoRedisV9Client and NewRedigoClient, or with a fake
+// in tests.
+//
+// A Client may also implement
+//
+//	SetDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) error
+//	Ping(ctx context.Context) error
+//	Close() error
+//
+// SetDel sets key and deletes oldKey in a single transaction; without it
+// RegenerateID sets then deletes in two commands. Without Ping, the store
+// checks redis with Exists, and without Close, closing the store does nothing.
+//
+// Other features need optional methods implemented by the clients of this
+// package, with the signatures of the unexported interfaces declared next
+// to the features:
+//
+//   - HashMode: HSet, HGetAll, HGet and HSetIfExists.
+//   - The user index: ZAddNX, ZRem and ZRange.
+//   - Tags: SAdd, SRem and SMembers.
+//   - LockSession: SetNX and DelIfValue.
+//   - ListSessionIDs, ForEachSession, Flush, DeleteAll, DeleteWhere and
+//     DeleteExpired: Scan; Scan: ScanPage.
+//   - The TTL method of the store, DeleteExpired and SetRenewalThreshold:
+//     TTL.
+//   - SetLocalCache: GetWithTTL; SetCacheInvalidation: Publish and Subscribe.
+//   - StartExpiryListener: PSubscribe.
+//   - SetVersionCheck: SetIfVersion.
+//
+// If available, new sessions are written with SetNX, and sessions moved by
+// RegenerateID with SetNXDel, so they never overwrite an existing key,
+// instead of checking with Exists first, and DelPipelined, TTLPipelined and
+// GetPipelined batch the deletes and TTL reads of scans and the reads of
+// LoadMany.
+type Client interface {
+	// Get returns the value of key, or ErrNil if key does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set sets key to value, expiring after ttl if ttl is positive.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del deletes keys and returns how many existed.
+	Del(ctx context.Context, keys ...string) (int64, error)
+	// Expire sets the TTL of key and reports whether key exists.
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Exists reports whether key exists.
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// ErrNil is returned by Client.Get for missing keys.
+var ErrNil = errors.New("redisstore: nil")
+
+// NewGoRedisClient returns a Client running commands with a
+// github.com/go-redis/redis client.
+func NewGoRedisClient(c redisv6.UniversalClient) Client {
+	return goRedisV6{c}
+}
+
+// NewGoRedisV9Client returns a Client running commands with a
+// github.com/redis/go-redis/v9 client.
+func NewGoRedisV9Client(c redis.UniversalClient) Client {
+	return goRedisV9{c}
+}
+
+// goRedisV6 runs commands with a github.com/go-redis/redis client.
+type goRedisV6 struct {
+	c redisv6.UniversalClient
+}
+
+func (g goRedisV6) Get(ctx context.Context, key string) ([]byte, error) {
+	var b []byte
+	err := do(ctx, func() (err error) {
+		b, err = g.c.Get(key).Bytes()
+		return err
+	})
+	if err == redisv6.Nil {
+		return nil, ErrNil
+	}
+	if err != nil {
+		return nil, err // b may still be written by fn
+	}
+	return b, nil
+}
+
+func (g goRedisV6) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return do(ctx, func() error {
+		return g.c.Set(key, value, ttl).Err()
+	})
+}
+
+func (g goRedisV6) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	var set bool
+	err := do(ctx, func() (err error) {
+		set, err = g.c.SetNX(key, value, ttl).Result()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return set, nil
+}
+
+func (g goRedisV6) Del(ctx context.Context, keys ...string) (int64, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = g.c.Del(keys...).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (g goRedisV6) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	var found bool
+	err := do(ctx, func() (err error) {
+		found, err = g.c.Expire(key, ttl).Result()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+func (g goRedisV6) Exists(ctx context.Context, key string) (bool, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = g.c.Exists(key).Result()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (g goRedisV6) SetDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) error {
+	return do(ctx, func() error {
+		_, err := g.c.TxPipelined(func(pipe redisv6.Pipeliner) error {
+			pipe.Set(key, value, ttl)
+			pipe.Del(oldKey)
+			return nil
+		})
+		return err
+	})
+}
+
+func (g goRedisV6) Database() int {
+	switch c := g.c.(type) {
+	case *redisv6.Client:
+		return c.Options().DB
+	case *redisv6.ClusterClient:
+		return 0
+	}
+	return -1
+}
+
+var setNXDelV6 = redisv6.NewScript(setNXDelScript)
+
+func (g goRedisV6) SetNXDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) (bool, error) {
+	if _, ok := g.c.(*redisv6.ClusterClient); ok {
+		return setNXThenDel(ctx, g, key, value, ttl, oldKey) // the keys may be on different nodes
+	}
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = setNXDelV6.Run(g.c, []string{key, oldKey}, value, ttl.Milliseconds()).Int64()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (g goRedisV6) HSet(ctx context.Context, key string, fields map[string][]byte, ttl time.Duration) error {
+	return do(ctx, func() error {
+		_, err := g.c.TxPipelined(func(pipe redisv6.Pipeliner) error {
+			pipe.Del(key)
+			pipe.HMSet(key, hashValues(fields))
+			if ttl > 0 {
+				pipe.PExpire(key, ttl)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func (g goRedisV6) HGetAll(ctx context.Context, key string) (map[string][]byte, error) {
+	var m map[string]string
+	err := do(ctx, func() (err error) {
+		m, err = g.c.HGetAll(key).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashBytes(m), nil
+}
+
+func (g goRedisV6) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	var b []byte
+	err := do(ctx, func() (err error) {
+		b, err = g.c.HGet(key, field).Bytes()
+		return err
+	})
+	if err == redisv6.Nil {
+		return nil, ErrNil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+var hsetIfExistsV6 = redisv6.NewScript(hsetIfExistsScript)
+
+func (g goRedisV6) HSetIfExists(ctx context.Context, key, field string, value []byte) (bool, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = hsetIfExistsV6.Run(g.c, []string{key}, field, value).Int64()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+var delIfValueV6 = redisv6.NewScript(delIfValueScript)
+
+func (g goRedisV6) DelIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = delIfValueV6.Run(g.c, []string{key}, value).Int64()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+var zaddNXV6 = redisv6.NewScript(zaddNXScript)
+
+func (g goRedisV6) ZAddNX(ctx context.Context, key, member string, score int64, ttl time.Duration) error {
+	return do(ctx, func() error {
+		return zaddNXV6.Run(g.c, []string{key}, member, score, ttl.Milliseconds()).Err()
+	})
+}
+
+func (g goRedisV6) ZRem(ctx context.Context, key string, members ...string) error {
+	return do(ctx, func() error {
+		return g.c.ZRem(key, stringArgs(members)...).Err()
+	})
+}
+
+func (g goRedisV6) ZRange(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	err := do(ctx, func() (err error) {
+		members, err = g.c.ZRange(key, 0, -1).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+var saddV6 = redisv6.NewScript(saddScript)
+
+func (g goRedisV6) SAdd(ctx context.Context, key, member string, ttl time.Duration) error {
+	return do(ctx, func() error {
+		return saddV6.Run(g.c, []string{key}, member, ttl.Milliseconds()).Err()
+	})
+}
+
+func (g goRedisV6) SRem(ctx context.Context, key string, members ...string) error {
+	return do(ctx, func() error {
+		return g.c.SRem(key, stringArgs(members)...).Err()
+	})
+}
+
+func (g goRedisV6) SMembers(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	err := do(ctx, func() (err error) {
+		members, err = g.c.SMembers(key).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (g goRedisV6) Scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	fn = syncScan(fn)
+	scan := func(c redisv6.Cmdable) error {
+		var cursor uint64
+		for {
+			var keys []string
+			err := do(ctx, func() (err error) {
+				keys, cursor, err = c.Scan(cursor, match, scanCount).Result()
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := fn(keys); err != nil {
+					return err
+				}
+			}
+			if cursor == 0 {
+				return nil
+			}
+		}
+	}
+	if c, ok := g.c.(*redisv6.ClusterClient); ok {
+		return c.ForEachMaster(func(c *redisv6.Client) error {
+			return scan(c)
+		})
+	}
+	return scan(g.c)
+}
+
+func (g goRedisV6) ScanPage(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error) {
+	if _, ok := g.c.(*redisv6.ClusterClient); ok {
+		return nil, 0, errClusterScan
+	}
+	var keys []string
+	err := do(ctx, func() (err error) {
+		keys, cursor, err = g.c.Scan(cursor, match, count).Result()
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, cursor, nil
+}
+
+func (g goRedisV6) DelPipelined(ctx context.Context, keys ...string) (int64, error) {
+	var n int64
+	err := do(ctx, func() error {
+		cmds := make([]*redisv6.IntCmd, len(keys))
+		_, err := g.c.Pipelined(func(pipe redisv6.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Del(key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, cmd := range cmds {
+			total += cmd.Val()
+		}
+		n = total
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (g goRedisV6) GetPipelined(ctx context.Context, keys ...string) ([][]byte, error) {
+	var values [][]byte
+	err := do(ctx, func() error {
+		cmds := make([]*redisv6.StringCmd, len(keys))
+		_, err := g.c.Pipelined(func(pipe redisv6.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(key)
+			}
+			return nil
+		})
+		if err != nil && err != redisv6.Nil {
+			return err
+		}
+		got := make([][]byte, len(keys))
+		for i, cmd := range cmds {
+			b, err := cmd.Bytes()
+			if err == redisv6.Nil {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			got[i] = b
+		}
+		values = got
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (g goRedisV6) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	var (
+		value []byte
+		ttl   time.Duration
+	)
+	err := do(ctx, func() error {
+		var (
+			get  *redisv6.StringCmd
+			pttl *redisv6.DurationCmd
+		)
+		_, err := g.c.Pipelined(func(pipe redisv6.Pipeliner) error {
+			get = pipe.Get(key)
+			pttl = pipe.PTTL(key)
+			return nil
+		})
+		if err == redisv6.Nil {
+			return ErrNil
+		}
+		if err != nil {
+			return err
+		}
+		value, ttl = []byte(get.Val()), pttl.Val()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, ttl, nil
+}
+
+func (g goRedisV6) Publish(ctx context.Context, channel string, message []byte) error {
+	return do(ctx, func() error {
+		return g.c.Publish(channel, message).Err()
+	})
+}
+
+func (g goRedisV6) PSubscribe(ctx context.Context, pattern string, fn func(channel string, message []byte)) error {
+	ps := g.c.PSubscribe(pattern)
+	defer ps.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ps.Close() // ends ReceiveMessage
+		case <-stop:
+		}
+	}()
+	for {
+		m, err := ps.ReceiveMessage()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		fn(m.Channel, []byte(m.Payload))
+	}
+}
+
+func (g goRedisV6) Subscribe(ctx context.Context, channel string, fn func(message []byte)) (io.Closer, error) {
+	ps := g.c.Subscribe(channel)
+	err := do(ctx, func() error {
+		_, err := ps.Receive() // waits for the subscription
+		return err
+	})
+	if err != nil {
+		ps.Close()
+		return nil, err
+	}
+	ch := ps.Channel()
+	go func() {
+		for m := range ch {
+			fn([]byte(m.Payload))
+		}
+	}()
+	return ps, nil
+}
+
+func (g goRedisV6) TTLPipelined(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	var ttls []time.Duration
+	err := do(ctx, func() error {
+		cmds := make([]*redisv6.DurationCmd, len(keys))
+		_, err := g.c.Pipelined(func(pipe redisv6.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.PTTL(key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		got := make([]time.Duration, len(keys))
+		for i, cmd := range cmds {
+			got[i] = cmd.Val()
+		}
+		ttls = got
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ttls, nil
+}
+
+func (g goRedisV6) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := do(ctx, func() (err error) {
+		ttl, err = g.c.PTTL(key).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+var setIfVersionV6 = redisv6.NewScript(setIfVersionScript)
+
+func (g goRedisV6) SetIfVersion(ctx context.Context, key string, value []byte, ttl time.Duration, version []byte) (bool, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = setIfVersionV6.Run(g.c, []string{key}, value, version, ttl.Milliseconds()).Int64()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+var setIfEqualV6 = redisv6.NewScript(setIfEqualScript)
+
+func (g goRedisV6) SetIfEqual(ctx context.Context, key string, value []byte, ttl time.Duration, old []byte) (bool, error) {
+	var n int64
+	err := do(ctx, func() (err error) {
+		n, err = setIfEqualV6.Run(g.c, []string{key}, value, old, ttl.Milliseconds()).Int64()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (g goRedisV6) Ping(ctx context.Context) error {
+	return do(ctx, func() error {
+		return g.c.Ping().Err()
+	})
+}
+
+func (g goRedisV6) Close() error {
+	return g.c.Close()
+}
+
+// do runs fn, a redis call, and returns ctx's error as soon as ctx is done.
+// The go-redis v6 client can't abort a command in flight, so fn keeps
+// running in the background in that case.
+func do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goRedisV9 runs commands with a github.com/redis/go-redis/v9 client.
+type goRedisV9 struct {
+	c redis.UniversalClient
+}
+
+func (g goRedisV9) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := g.c.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNil
+	}
+	return b, err
+}
+
+func (g goRedisV9) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return g.c.Set(ctx, key, value, ttl).Err()
+}
+
+func (g goRedisV9) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return g.c.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (g goRedisV9) Del(ctx context.Context, keys ...string) (int64, error) {
+	return g.c.Del(ctx, keys...).Result()
+}
+
+func (g goRedisV9) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return g.c.Expire(ctx, key, ttl).Result()
+}
+
+func (g goRedisV9) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := g.c.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (g goRedisV9) SetDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) error {
+	_, err := g.c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		pipe.Del(ctx, oldKey)
+		return nil
+	})
+	return err
+}
+
+func (g goRedisV9) Database() int {
+	switch c := g.c.(type) {
+	case *redis.Client:
+		return c.Options().DB
+	case *redis.ClusterClient:
+		return 0
+	}
+	return -1
+}
+
+var setNXDelV9 = redis.NewScript(setNXDelScript)
+
+func (g goRedisV9) SetNXDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) (bool, error) {
+	if _, ok := g.c.(*redis.ClusterClient); ok {
+		return setNXThenDel(ctx, g, key, value, ttl, oldKey) // the keys may be on different nodes
+	}
+	n, err := setNXDelV9.Run(ctx, g.c, []string{key, oldKey}, value, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (g goRedisV9) HSet(ctx context.Context, key string, fields map[string][]byte, ttl time.Duration) error {
+	_, err := g.c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, hashValues(fields))
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (g goRedisV9) HGetAll(ctx context.Context, key string) (map[string][]byte, error) {
+	m, err := g.c.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return hashBytes(m), nil
+}
+
+func (g goRedisV9) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	b, err := g.c.HGet(ctx, key, field).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNil
+	}
+	return b, err
+}
+
+var hsetIfExistsV9 = redis.NewScript(hsetIfExistsScript)
+
+func (g goRedisV9) HSetIfExists(ctx context.Context, key, field string, value []byte) (bool, error) {
+	n, err := hsetIfExistsV9.Run(ctx, g.c, []string{key}, field, value).Int64()
+	return n == 1, err
+}
+
+var delIfValueV9 = redis.NewScript(delIfValueScript)
+
+func (g goRedisV9) DelIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	n, err := delIfValueV9.Run(ctx, g.c, []string{key}, value).Int64()
+	return n == 1, err
+}
+
+var zaddNXV9 = redis.NewScript(zaddNXScript)
+
+func (g goRedisV9) ZAddNX(ctx context.Context, key, member string, score int64, ttl time.Duration) error {
+	return zaddNXV9.Run(ctx, g.c, []string{key}, member, score, ttl.Milliseconds()).Err()
+}
+
+func (g goRedisV9) ZRem(ctx context.Context, key string, members ...string) error {
+	return g.c.ZRem(ctx, key, stringArgs(members)...).Err()
+}
+
+func (g goRedisV9) ZRange(ctx context.Context, key string) ([]string, error) {
+	return g.c.ZRange(ctx, key, 0, -1).Result()
+}
+
+var saddV9 = redis.NewScript(saddScript)
+
+func (g goRedisV9) SAdd(ctx context.Context, key, member string, ttl time.Duration) error {
+	return saddV9.Run(ctx, g.c, []string{key}, member, ttl.Milliseconds()).Err()
+}
+
+func (g goRedisV9) SRem(ctx context.Context, key string, members ...string) error {
+	return g.c.SRem(ctx, key, stringArgs(members)...).Err()
+}
+
+func (g goRedisV9) SMembers(ctx context.Context, key string) ([]string, error) {
+	return g.c.SMembers(ctx, key).Result()
+}
+
+func (g goRedisV9) Scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	fn = syncScan(fn)
+	scan := func(ctx context.Context, c redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := c.Scan(ctx, cursor, match, scanCount).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := fn(keys); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if c, ok := g.c.(*redis.ClusterClient); ok {
+		return c.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scan(ctx, c)
+		})
+	}
+	return scan(ctx, g.c)
+}
+
+func (g goRedisV9) ScanPage(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error) {
+	if _, ok := g.c.(*redis.ClusterClient); ok {
+		return nil, 0, errClusterScan
+	}
+	return g.c.Scan(ctx, cursor, match, count).Result()
+}
+
+func (g goRedisV9) DelPipelined(ctx context.Context, keys ...string) (int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := g.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, err
+}
+
+func (g goRedisV9) GetPipelined(ctx context.Context, keys ...string) ([][]byte, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := g.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = b
+	}
+	return values, nil
+}
+
+func (g goRedisV9) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	var (
+		get  *redis.StringCmd
+		pttl *redis.DurationCmd
+	)
+	_, err := g.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, 0, ErrNil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	b, _ := get.Bytes()
+	return b, pttl.Val(), nil
+}
+
+func (g goRedisV9) Publish(ctx context.Context, channel string, message []byte) error {
+	return g.c.Publish(ctx, channel, message).Err()
+}
+
+func (g goRedisV9) PSubscribe(ctx context.Context, pattern string, fn func(channel string, message []byte)) error {
+	ps := g.c.PSubscribe(ctx, pattern)
+	defer ps.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ps.Close() // ends ReceiveMessage, which only uses deadlines of ctx
+		case <-stop:
+		}
+	}()
+	for {
+		m, err := ps.ReceiveMessage(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		fn(m.Channel, []byte(m.Payload))
+	}
+}
+
+func (g goRedisV9) Subscribe(ctx context.Context, channel string, fn func(message []byte)) (io.Closer, error) {
+	ps := g.c.Subscribe(ctx, channel)
+	if _, err := ps.Receive(ctx); err != nil { // waits for the subscription
+		ps.Close()
+		return nil, err
+	}
+	ch := ps.Channel()
+	go func() {
+		for m := range ch {
+			fn([]byte(m.Payload))
+		}
+	}()
+	return ps, nil
+}
+
+func (g goRedisV9) TTLPipelined(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	cmds := make([]*redis.DurationCmd, len(keys))
+	_, err := g.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ttls := make([]time.Duration, len(keys))
+	for i, cmd := range cmds {
+		ttls[i] = cmd.Val()
+	}
+	return ttls, nil
+}
+
+func (g goRedisV9) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return g.c.PTTL(ctx, key).Result()
+}
+
+var setIfVersionV9 = redis.NewScript(setIfVersionScript)
+
+func (g goRedisV9) SetIfVersion(ctx context.Context, key string, value []byte, ttl time.Duration, version []byte) (bool, error) {
+	n, err := setIfVersionV9.Run(ctx, g.c, []string{key}, value, version, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+var setIfEqualV9 = redis.NewScript(setIfEqualScript)
+
+func (g goRedisV9) SetIfEqual(ctx context.Context, key string, value []byte, ttl time.Duration, old []byte) (bool, error) {
+	n, err := setIfEqualV9.Run(ctx, g.c, []string{key}, value, old, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (g goRedisV9) Ping(ctx context.Context) error {
+	return g.c.Ping(ctx).Err()
+}
+
+func (g goRedisV9) Close() error {
+	return g.c.Close()
+}
+
+// hashValues converts hash fields to the values taken by go-redis.
+func hashValues(fields map[string][]byte) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		m[k] = v
+	}
+	return m
+}
+
+// hashBytes converts hash fields read by go-redis.
+func hashBytes(m map[string]string) map[string][]byte {
+	fields := make(map[string][]byte, len(m))
+	for k, v := range m {
+		fields[k] = []byte(v)
+	}
+	return fields
+}
+
+// stringArgs converts strings to the arguments taken by go-redis.
+func stringArgs(strs []string) []interface{} {
+	args := make([]interface{}, len(strs))
+	for i, s := range strs {
+		args[i] = s
+	}
+	return args
+}
+
+// syncScan serializes the calls to fn, which are concurrent when scanning
+// the nodes of a cluster.
+func syncScan(fn func(keys []string) error) func(keys []string) error {
+	var mu sync.Mutex
+	return func(keys []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return fn(keys)
+	}
+}
+
+// setNXThenDel sets key with SetNX and then deletes oldKey if key was set, in
+// two commands, for keys that can't be used by a single script.
+func setNXThenDel(ctx context.Context, c interface {
+	Client
+	setNXClient
+}, key string, value []byte, ttl time.Duration, oldKey string) (bool, error) {
+	set, err := c.SetNX(ctx, key, value, ttl)
+	if err != nil || !set {
+		return false, err
+	}
+	_, err = c.Del(ctx, oldKey)
+	return true, err
+}
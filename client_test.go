@@ -0,0 +1,163 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redisv6 "github.com/go-redis/redis"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRedisStoreV6Client(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	clientV6 := redisv6.NewClient(&redisv6.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { clientV6.Close() })
+	storeV6 := NewRedisStoreWithClient(NewGoRedisClient(clientV6), []byte("secret"))
+	storeV9 := NewRedisStore(client, []byte("secret"))
+
+	for _, tt := range []struct {
+		name        string
+		write, read *Store
+	}{
+		{"v6 to v9", storeV6, storeV9},
+		{"v9 to v6", storeV9, storeV6},
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := tt.write.Get(req, sessionName)
+		session.Values["key"] = tt.name
+		res := httptest.NewRecorder()
+		if err := tt.write.Save(req, res, session); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		req2, _ := http.NewRequest("GET", "/", nil)
+		req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		session2, err := tt.read.Get(req2, sessionName)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if session2.IsNew || session2.Values["key"] != tt.name {
+			t.Errorf("%s: expected session to be readable", tt.name)
+		}
+
+		session2.Options.MaxAge = -1
+		if err := tt.read.Save(req2, httptest.NewRecorder(), session2); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if mr.Exists(session.ID) {
+			t.Errorf("%s: expected session to be deleted", tt.name)
+		}
+	}
+}
+
+// clients returns a Client of every supported library connected to mr.
+func clients(t *testing.T, mr *miniredis.Miniredis) map[string]Client {
+	clientV6 := redisv6.NewClient(&redisv6.Options{Addr: mr.Addr()})
+	clientV9 := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	pool := &redigo.Pool{Dial: func() (redigo.Conn, error) {
+		return redigo.Dial("tcp", mr.Addr())
+	}}
+	t.Cleanup(func() {
+		clientV6.Close()
+		clientV9.Close()
+		pool.Close()
+	})
+	return map[string]Client{
+		"go-redis":    NewGoRedisClient(clientV6),
+		"go-redis/v9": NewGoRedisV9Client(clientV9),
+		"redigo":      NewRedigoClient(pool),
+	}
+}
+
+func TestClientConformance(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, mr, NewRedisStoreWithClient(c, []byte("secret")))
+		})
+	}
+}
+
+// testStore runs the main scenarios of the store against store.
+func testStore(t *testing.T, mr *miniredis.Miniredis, store *Store) {
+	if err := store.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, err := store.Get(req, sessionName)
+	if err != nil || !session.IsNew {
+		t.Fatalf("expected a new session, got %v", err)
+	}
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	get := func(res *httptest.ResponseRecorder) *sessions.Session {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		session, err := store.Get(req, sessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	if s := get(res); s.IsNew || s.Values["key"] != ok {
+		t.Error("expected saved session to load")
+	}
+
+	mr.FastForward(time.Duration(store.RedisStore.Options.MaxAge-10) * time.Second)
+	if err := store.Touch(session); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(20 * time.Second)
+	if s := get(res); s.IsNew {
+		t.Error("expected touched session to be alive")
+	}
+
+	res2 := httptest.NewRecorder()
+	if err := store.RegenerateID(req, res2, session); err != nil {
+		t.Fatal(err)
+	}
+	if s := get(res); !s.IsNew {
+		t.Error("expected old session ID to be gone after regeneration")
+	}
+	if s := get(res2); s.IsNew || s.Values["key"] != ok {
+		t.Error("expected regenerated session to load")
+	}
+
+	if existed, err := store.Delete(session.ID); err != nil || !existed {
+		t.Errorf("expected session to be deleted, got %v, %v", existed, err)
+	}
+	if s := get(res2); !s.IsNew {
+		t.Error("expected deleted session to be gone")
+	}
+
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedigoMultiErrors(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	conn, err := redigo.Dial("tcp", mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	if err := multi(ctx, conn, redigo.Args{"SET", "key", "value"}, redigo.Args{"DEL", "other"}); err != nil {
+		t.Fatal(err)
+	}
+	err = multi(ctx, conn, redigo.Args{"SET", "key", "value"}, redigo.Args{"INCR", "key"})
+	if err == nil {
+		t.Error("expected the error of a command of the transaction")
+	}
+}
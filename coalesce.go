@@ -0,0 +1,36 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+)
+
+// SetCoalesceLoads makes concurrent loads of the same session, e.g. from a
+// burst of parallel requests with the same cookie, share a single redis
+// read. Each load still decodes the data itself, so sessions never share
+// their values. Loads whose shared read was cancelled with the context of
+// another load read the session again on their own. HashMode sessions are
+// not coalesced. Loads aren't coalesced by default.
+func (rs *RedisStore) SetCoalesceLoads(on bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.coalesce = on
+}
+
+// fetch returns the data of key like get, sharing the read with concurrent
+// fetches of key if loads are coalesced.
+func (rs *RedisStore) fetch(ctx context.Context, key string) ([]byte, error) {
+	if !rs.coalesce {
+		return rs.get(ctx, key)
+	}
+	v, err, _ := rs.loads.Do(key, func() (interface{}, error) {
+		return rs.get(ctx, key)
+	})
+	if err != nil && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return rs.get(ctx, key) // read with the context of another load
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowClient is a Client counting GETs, which take a while.
+type slowClient struct {
+	Client
+	gets int64
+}
+
+func (c *slowClient) Get(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.gets, 1)
+	time.Sleep(50 * time.Millisecond)
+	return c.Client.Get(ctx, key)
+}
+
+func TestSetCoalesceLoads(t *testing.T) {
+	_, client := newMiniRedis(t)
+	slow := &slowClient{Client: NewGoRedisV9Client(client)}
+	store := NewRedisStoreWithClient(slow, []byte("secret"))
+	store.SetCoalesceLoads(true)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	session.Values["list"] = []string{"a", "b"}
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	cookie := res.Header().Get("Set-Cookie")
+
+	const n = 50
+	var wg sync.WaitGroup
+	loaded := make([]map[interface{}]interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Cookie", cookie)
+			s, err := store.New(req, sessionName)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			loaded[i] = s.Values
+		}(i)
+	}
+	wg.Wait()
+	if gets := atomic.LoadInt64(&slow.gets); gets >= 10 {
+		t.Errorf("expected the loads to share GETs, got %d", gets)
+	}
+	for i, values := range loaded {
+		if values["key"] != ok {
+			t.Fatalf("load %d: expected the session values, got %v", i, values)
+		}
+	}
+	loaded[0]["key"] = "changed"
+	loaded[0]["list"].([]string)[0] = "changed"
+	if loaded[1]["key"] != ok || loaded[1]["list"].([]string)[0] != "a" {
+		t.Error("expected each load to get its own values")
+	}
+}
@@ -0,0 +1,120 @@
+package redisstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gorilla/sessions"
+)
+
+// Header byte of payloads stored with compression enabled.
+const (
+	rawPayload  byte = 0
+	gzipPayload byte = 1
+)
+
+// SetCompression enables gzip compression of the serialized session.
+// Compressed payloads carry a header byte, so sessions stored before
+// compression was toggled can't be read afterwards.
+func (rs *RedisStore) SetCompression(enabled bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.compress = enabled
+}
+
+// SetCompressionThreshold makes a store with compression enabled compress
+// only serialized sessions over n bytes, as compressing small ones wastes CPU
+// and can make them bigger. Smaller sessions are stored raw after a header
+// byte telling them apart, so the threshold can be changed at any time.
+// Zero, the default, compresses every session.
+func (rs *RedisStore) SetCompressionThreshold(n int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.compressMin = n
+}
+
+// CompressedSerializer wraps another serializer and gzips its output once
+// it exceeds Threshold bytes. Compressed payloads are prefixed with a marker
+// byte; smaller ones are stored exactly as Inner produced them, so sessions
+// saved before the wrapper was introduced can still be read. The store's max
+// length applies to the compressed size.
+type CompressedSerializer struct {
+	// Inner does the actual serialization. GobSerializer is used when nil.
+	Inner     SessionSerializer
+	Threshold int
+}
+
+// Serialize with Inner, compressing the result if it is over the threshold.
+func (s CompressedSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	b, err := s.inner().Serialize(ss)
+	if err != nil || len(b) <= s.Threshold {
+		return b, err
+	}
+	return compress(b)
+}
+
+// Deserialize data written by Serialize, or raw data written by Inner.
+func (s CompressedSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	if isCompressed(d) {
+		b, err := decompress(d)
+		if err != nil {
+			return err
+		}
+		d = b
+	}
+	return s.inner().Deserialize(d, ss)
+}
+
+func (s CompressedSerializer) inner() SessionSerializer {
+	if s.Inner == nil {
+		return GobSerializer{}
+	}
+	return s.Inner
+}
+
+// isCompressed reports whether data starts with the gzip payload header
+// followed by the gzip magic number.
+func isCompressed(data []byte) bool {
+	return len(data) >= 3 && data[0] == gzipPayload && data[1] == 0x1f && data[2] == 0x8b
+}
+
+// raw prepends the raw payload header to b.
+func raw(b []byte) []byte {
+	return append([]byte{rawPayload}, b...)
+}
+
+// compress gzips b and prepends the payload header.
+func compress(b []byte) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{gzipPayload})
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress reads the payload header and gunzips data if needed.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("redisstore: missing payload header")
+	}
+	switch data[0] {
+	case rawPayload:
+		return data[1:], nil
+	case gzipPayload:
+		zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("redisstore: unknown payload header %#x", data[0])
+	}
+}
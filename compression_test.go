@@ -0,0 +1,133 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSetCompression(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetCompression(true)
+
+	value := strings.Repeat("compressible ", 1000)
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = value
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatalf("expected compressed session to fit max length, got %v", err)
+	}
+
+	stored, err := mr.Get(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored[0] != gzipPayload {
+		t.Errorf("expected gzip header, got %#x", stored[0])
+	}
+	if len(stored) >= len(value) {
+		t.Errorf("expected compression to reduce size, stored %d bytes", len(stored))
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session2.Values["key"] != value {
+		t.Error("expected compressed session to round-trip")
+	}
+}
+
+func TestSetCompressionThreshold(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetCompression(true)
+	store.SetCompressionThreshold(512)
+
+	for _, tc := range []struct {
+		value  string
+		header byte
+	}{
+		{"small", rawPayload},
+		{strings.Repeat("compressible ", 1000), gzipPayload},
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		session.Values["key"] = tc.value
+		res := httptest.NewRecorder()
+		if err := store.Save(req, res, session); err != nil {
+			t.Fatal(err)
+		}
+		if stored, _ := mr.Get(session.ID); stored[0] != tc.header {
+			t.Errorf("%d bytes: expected header %#x, got %#x", len(tc.value), tc.header, stored[0])
+		}
+		s, err := store.New(requestWith(res), sessionName)
+		if err != nil || s.Values["key"] != tc.value {
+			t.Errorf("%d bytes: expected the session to round-trip, got %v", len(tc.value), err)
+		}
+	}
+}
+
+func TestCompressedSerializer(t *testing.T) {
+	s := CompressedSerializer{Inner: JSONSerializer{}, Threshold: 100}
+	for _, n := range []int{1, 80, 90, 100, 1000} {
+		ss := sessions.NewSession(nil, sessionName)
+		ss.Values["key"] = strings.Repeat("a", n)
+		raw, _ := JSONSerializer{}.Serialize(ss)
+
+		b, err := s.Serialize(ss)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed := isCompressed(b); compressed != (len(raw) > s.Threshold) {
+			t.Errorf("%d bytes: expected compressed to be %v", len(raw), !compressed)
+		}
+		decoded := sessions.NewSession(nil, sessionName)
+		if err := s.Deserialize(b, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Values["key"] != ss.Values["key"] {
+			t.Errorf("%d bytes: expected value to round-trip", len(raw))
+		}
+	}
+}
+
+func TestCompressedSerializerReadsUncompressed(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	value := strings.Repeat("compressible ", 1000)
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = value
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err == nil {
+		t.Fatal("expected uncompressed session to exceed max length")
+	}
+	session.Values["key"] = ok
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetSerializer(CompressedSerializer{Threshold: 256})
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session2.Values["key"] != ok {
+		t.Errorf("expected old uncompressed session to be readable, got %v", session2.Values["key"])
+	}
+	session2.Values["key"] = value
+	if err := store.Save(req2, httptest.NewRecorder(), session2); err != nil {
+		t.Fatalf("expected compressed size to be checked against max length, got %v", err)
+	}
+}
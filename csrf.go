@@ -0,0 +1,116 @@
+package redisstore
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// csrfKey is the session value holding the CSRF token of a session.
+const csrfKey = "redisstore.csrf"
+
+// Size in random bytes of CSRF tokens.
+const csrfTokenSize = 32
+
+// Where WithCSRF looks for the CSRF token of state-changing requests, and
+// sets it for templates.
+const (
+	// CSRFHeader is the request header carrying the CSRF token, also set in
+	// the responses of WithCSRF.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFFormField is the form field carrying the CSRF token, and the key of
+	// the token in the gin context.
+	CSRFFormField = "csrf_token"
+)
+
+// CSRFToken returns the CSRF token of session, generating a random one kept
+// in its values if it has none yet; the session must be saved to keep a new
+// token. RegenerateID replaces the token of a session with a new one, so a
+// token seen before login is useless after it. It returns an error, rather
+// than a token that isn't random, if the source of randomness fails.
+func (rs *RedisStore) CSRFToken(session *sessions.Session) (string, error) {
+	token, _, err := csrfToken(session)
+	return token, err
+}
+
+// ValidateCSRF reports whether token is the CSRF token of session, in
+// constant time. Sessions without a token never validate.
+func (rs *RedisStore) ValidateCSRF(session *sessions.Session, token string) bool {
+	want, _ := session.Values[csrfKey].(string)
+	return want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(token)) == 1
+}
+
+// WithCSRF returns a gin middleware protecting the session name against CSRF.
+// The token of the session, see CSRFToken, is set in the CSRFHeader header of
+// responses and under CSRFFormField in the gin context, e.g. for templates;
+// sessions getting a new token are saved. Requests other than GET, HEAD,
+// OPTIONS and TRACE must carry the token in the CSRFHeader header or the
+// CSRFFormField form field, or are aborted with 403 Forbidden. Requests
+// failing to reach redis are aborted with 503 Service Unavailable. The
+// session is loaded with Get, so the sessions middleware of gin reuses it.
+func (rs *RedisStore) WithCSRF(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := rs.Get(c.Request, name)
+		if errors.Is(err, ErrInvalidCookie) {
+			err = nil // a fresh session, getting a new token
+		}
+		var (
+			token   string
+			created bool
+		)
+		if err == nil {
+			token, created, err = csrfToken(session)
+		}
+		if err == nil && created {
+			err = rs.Save(c.Request, c.Writer, session)
+		}
+		switch {
+		case errors.Is(err, ErrRedisUnavailable):
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+			return
+		case err != nil:
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Header(CSRFHeader, token)
+		c.Set(CSRFFormField, token)
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			got := c.GetHeader(CSRFHeader)
+			if got == "" {
+				got = c.PostForm(CSRFFormField)
+			}
+			if created || !rs.ValidateCSRF(session, got) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// csrfToken returns the CSRF token of session and whether it was just
+// generated.
+func csrfToken(session *sessions.Session) (token string, created bool, err error) {
+	if token, _ := session.Values[csrfKey].(string); token != "" {
+		return token, false, nil
+	}
+	if token, err = newCSRFToken(session); err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// newCSRFToken sets a new random CSRF token in the values of session.
+func newCSRFToken(session *sessions.Session) (string, error) {
+	token, err := Base64IDGenerator{csrfTokenSize}.Generate()
+	if err != nil {
+		return "", err
+	}
+	session.Values[csrfKey] = token
+	return token, nil
+}
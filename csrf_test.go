@@ -0,0 +1,104 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFToken(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	if store.ValidateCSRF(session, "") {
+		t.Error("expected a session without a token not to validate")
+	}
+	token, err := store.CSRFToken(session)
+	if err != nil || len(token) < 43 {
+		t.Fatalf("expected a 32 bytes token, got %q, %v", token, err)
+	}
+	if again, _ := store.CSRFToken(session); again != token {
+		t.Error("expected the token to be kept in the session")
+	}
+	if store.ValidateCSRF(session, "wrong") || store.ValidateCSRF(session, "") {
+		t.Error("expected a wrong token not to validate")
+	}
+	if !store.ValidateCSRF(session, token) {
+		t.Error("expected the token to validate")
+	}
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	// login
+	if err := store.RegenerateID(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := store.CSRFToken(session)
+	if rotated == token || store.ValidateCSRF(session, token) || !store.ValidateCSRF(session, rotated) {
+		t.Error("expected RegenerateID to rotate the token")
+	}
+
+	mr.Close()
+	if err := store.RegenerateID(req, httptest.NewRecorder(), session); err == nil {
+		t.Fatal("expected RegenerateID to fail without redis")
+	}
+	if !store.ValidateCSRF(session, rotated) {
+		t.Error("expected a failed RegenerateID to keep the stored token")
+	}
+}
+
+func TestWithCSRF(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	r := gin.New()
+	r.Use(sessions.Sessions(sessionName, store), store.WithCSRF(sessionName))
+	handler := func(c *gin.Context) { c.String(http.StatusOK, c.GetString(CSRFFormField)) }
+	r.GET("/", handler)
+	r.POST("/", handler)
+	post := func(cookie, token string, form url.Values) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Cookie", cookie)
+		if token != "" {
+			req.Header.Set(CSRFHeader, token)
+		}
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(r, "/", nil)
+	token := res.Header().Get(CSRFHeader)
+	if res.Code != http.StatusOK || token == "" || res.Body.String() != token {
+		t.Fatalf("expected the token in the response and the context, got %d %q", res.Code, token)
+	}
+	cookie := res.Header().Get("Set-Cookie")
+	if again := serve(r, "/", http.Header{"Cookie": {cookie}}).Header().Get(CSRFHeader); again != token {
+		t.Errorf("expected the token to be kept in the session, got %q", again)
+	}
+
+	if res := post(cookie, "", nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without a token, got %d", res.Code)
+	}
+	if res := post(cookie, "wrong", nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a wrong token, got %d", res.Code)
+	}
+	if res := post("", token, nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a token without its session, got %d", res.Code)
+	}
+	if res := post(cookie, token, nil); res.Code != http.StatusOK {
+		t.Errorf("expected the token in the header to be accepted, got %d", res.Code)
+	}
+	if res := post(cookie, "", url.Values{CSRFFormField: {token}}); res.Code != http.StatusOK {
+		t.Errorf("expected the token in the form to be accepted, got %d", res.Code)
+	}
+}
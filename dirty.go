@@ -0,0 +1,71 @@
+package redisstore
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// sessionState is the store of sessions created by New. It tracks what was
+// loaded from redis so Save can tell whether a session changed.
+type sessionState struct {
+	*RedisStore
+	id          string           // ID the cookie was last set or loaded with
+	options     sessions.Options // options the cookie was last set or loaded with
+	loaded      []byte           // serialized values as last read or written
+	created     time.Time        // creation time of the session, if known
+	lastAccess  time.Time        // time the session was last saved, if known
+	fingerprint string           // fingerprint of the client of the session
+	version     []byte           // version of the session as last read or written
+}
+
+// state returns the sessionState of session, or nil if the session was not
+// created by this store.
+func (rs *RedisStore) state(session *sessions.Session) *sessionState {
+	st, _ := session.Store().(*sessionState)
+	return st
+}
+
+// SetResaveUnchanged sets whether Save writes sessions whose values did not
+// change since they were loaded. It defaults to true. When false, Save only
+// refreshes the TTL of unchanged sessions and sets the cookie only if the
+// session ID or options changed.
+func (rs *RedisStore) SetResaveUnchanged(v bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.skipUnchanged = !v
+}
+
+// valuesUnchanged reports whether plain, the serialized values of session,
+// are the same as loaded.
+func (st *sessionState) valuesUnchanged(plain []byte, session *sessions.Session) bool {
+	if st.loaded == nil {
+		return false
+	}
+	if bytes.Equal(plain, st.loaded) {
+		return true
+	}
+	// Serializers like gob don't encode maps in a stable order, and the last
+	// access time changes with every save.
+	old := sessions.NewSession(st, session.Name())
+	if err := st.serializer.Deserialize(st.loaded, old); err != nil {
+		return false
+	}
+	lastAccess, stamped := session.Values[lastAccessKey]
+	delete(old.Values, lastAccessKey)
+	delete(session.Values, lastAccessKey)
+	defer func() {
+		if stamped {
+			session.Values[lastAccessKey] = lastAccess
+		}
+	}()
+	return reflect.DeepEqual(old.Values, session.Values)
+}
+
+// cookieUnchanged reports whether the cookie of session was already set
+// with its current ID and options.
+func (st *sessionState) cookieUnchanged(session *sessions.Session) bool {
+	return st.id != "" && st.id == session.ID && st.options == *session.Options
+}
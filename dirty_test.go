@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// countCommands makes client count the commands it sends by name.
+func countCommands(client *redis.Client) map[string]int {
+	counts := make(map[string]int)
+	client.AddHook(commandHook(func(cmd redis.Cmder) {
+		counts[strings.ToLower(cmd.Name())]++
+	}))
+	return counts
+}
+
+func TestSetResaveUnchanged(t *testing.T) {
+	_, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetResaveUnchanged(false)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	for i := 0; i < 10; i++ {
+		session.Values[i] = i // maps with several keys aren't gob encoded in a stable order
+	}
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 1 {
+		t.Fatalf("expected 1 SET for a new session, got %d", counts["set"])
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2 := httptest.NewRecorder()
+	if err := store.Save(req2, res2, session2); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 1 || counts["expire"] != 1 {
+		t.Errorf("expected unchanged session to only be expired, got %d SET and %d EXPIRE", counts["set"], counts["expire"])
+	}
+	if res2.Header().Get("Set-Cookie") != "" {
+		t.Error("expected no cookie for an unchanged session")
+	}
+
+	session2.Values["key"] = ok
+	if err := store.Save(req2, httptest.NewRecorder(), session2); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 2 {
+		t.Errorf("expected changed session to be written, got %d SET", counts["set"])
+	}
+
+	store.SetResaveUnchanged(true)
+	if err := store.Save(req2, httptest.NewRecorder(), session2); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 3 {
+		t.Errorf("expected unchanged session to be written when resaving, got %d SET", counts["set"])
+	}
+}
@@ -0,0 +1,124 @@
+package redisstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/sessions"
+)
+
+// SetEncryptionKey enables AES-GCM encryption of the session data stored in
+// redis. The key must be 32 bytes long; a nil key disables encryption.
+func (rs *RedisStore) SetEncryptionKey(key []byte) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if key == nil {
+		rs.aead = nil
+		return nil
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("redisstore: encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	rs.aead = aead
+	return nil
+}
+
+// Version byte of payloads written by EncryptedSerializer.
+const encryptedPayloadV1 byte = 1
+
+// EncryptedSerializer wraps another serializer and encrypts its output with
+// AES-GCM. Data is always encrypted with the first key; the others are only
+// used for decryption so that keys can be rotated by prepending a new one.
+type EncryptedSerializer struct {
+	inner SessionSerializer
+	keys  []cipher.AEAD
+}
+
+// NewEncryptedSerializer returns a serializer encrypting the output of inner,
+// GobSerializer if nil, with the given 32 byte keys. At least one key is
+// required.
+func NewEncryptedSerializer(inner SessionSerializer, keys ...[]byte) (*EncryptedSerializer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("redisstore: no encryption keys given")
+	}
+	if inner == nil {
+		inner = GobSerializer{}
+	}
+	s := &EncryptedSerializer{inner: inner}
+	for i, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("redisstore: encryption key %d must be 32 bytes, got %d", i, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, aead)
+	}
+	return s, nil
+}
+
+// Serialize with the inner serializer and encrypt with the primary key.
+func (s *EncryptedSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	b, err := s.inner.Serialize(ss)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encrypt(s.keys[0], b)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{encryptedPayloadV1}, sealed...), nil
+}
+
+// Deserialize decrypts d with the first key that opens it.
+func (s *EncryptedSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	if len(d) == 0 || d[0] != encryptedPayloadV1 {
+		return errors.New("redisstore: unknown encrypted payload version")
+	}
+	var err error
+	for _, aead := range s.keys {
+		var b []byte
+		if b, err = decrypt(aead, d[1:]); err == nil {
+			return s.inner.Deserialize(b, ss)
+		}
+	}
+	return err
+}
+
+// encrypt seals b with a random nonce, which is prepended to the result.
+func encrypt(aead cipher.AEAD, b []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, b, nil), nil
+}
+
+// decrypt opens data produced by encrypt.
+func decrypt(aead cipher.AEAD, data []byte) ([]byte, error) {
+	n := aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("redisstore: encrypted payload too short")
+	}
+	b, err := aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("redisstore: cannot decrypt session: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,126 @@
+package redisstore
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSetEncryptionKey(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.SetEncryptionKey([]byte("short")); err == nil {
+		t.Error("expected error for a key that is not 32 bytes")
+	}
+	if err := store.SetEncryptionKey(bytes.Repeat([]byte("k"), 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = "plaintext-value"
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := mr.Get(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "plaintext-value") {
+		t.Error("expected session data to be encrypted in redis")
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if s, err := store.Get(req2, sessionName); err != nil || s.Values["key"] != "plaintext-value" {
+		t.Fatalf("expected encrypted session to round-trip, got %v", err)
+	}
+
+	store.StrictDecode = true
+	tampered := []byte(stored)
+	tampered[len(tampered)-1] ^= 0xff
+	mr.Set(session.ID, string(tampered))
+	if _, err := store.New(req2, sessionName); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Errorf("expected decrypt error for tampered data, got %v", err)
+	}
+}
+
+func TestEncryptedSerializer(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte("o"), 32), bytes.Repeat([]byte("n"), 32)
+	if _, err := NewEncryptedSerializer(nil); err == nil {
+		t.Error("expected error without keys")
+	}
+	if _, err := NewEncryptedSerializer(nil, newKey, []byte("short")); err == nil {
+		t.Error("expected error for a key that is not 32 bytes")
+	}
+	old, err := NewEncryptedSerializer(nil, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewEncryptedSerializer(nil, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss := sessions.NewSession(nil, sessionName)
+	ss.Values["key"] = "plaintext-value"
+	b, err := old.Serialize(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("plaintext-value")) {
+		t.Error("expected serialized data to be encrypted")
+	}
+	decoded := sessions.NewSession(nil, sessionName)
+	if err := rotated.Deserialize(b, decoded); err != nil || decoded.Values["key"] != "plaintext-value" {
+		t.Errorf("expected old session to be readable after rotation, got %v", err)
+	}
+
+	b, _ = rotated.Serialize(ss)
+	if err := old.Deserialize(b, sessions.NewSession(nil, sessionName)); err == nil {
+		t.Error("expected data to be encrypted with the new primary key")
+	}
+	b[len(b)-1] ^= 0xff
+	if err := rotated.Deserialize(b, sessions.NewSession(nil, sessionName)); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Errorf("expected decrypt error for tampered data, got %v", err)
+	}
+}
+
+func TestEncryptedSerializerSwap(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	encrypted, err := NewEncryptedSerializer(GobSerializer{}, bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, swap := range []SessionSerializer{encrypted, GobSerializer{}} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		session.Values["key"] = ok
+		res := httptest.NewRecorder()
+		if err := store.Save(req, res, session); err != nil {
+			t.Fatal(err)
+		}
+
+		store.SetSerializer(swap)
+		req2, _ := http.NewRequest("GET", "/", nil)
+		req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		session2, err := store.Get(req2, sessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !session2.IsNew || len(session2.Values) != 0 {
+			t.Errorf("expected %T to reset a session it cannot read", swap)
+		}
+		session2.Values["key"] = ok
+		if err := store.Save(req2, httptest.NewRecorder(), session2); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
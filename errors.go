@@ -0,0 +1,115 @@
+package redisstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSessionNotFound is returned when the session has no data in redis,
+// e.g. because it expired.
+var ErrSessionNotFound = errors.New("redisstore: session not found")
+
+// ErrDecodeFailed is returned when a session read from redis can't be
+// decoded. The error returned wraps the one of the serializer.
+var ErrDecodeFailed = errors.New("redisstore: cannot decode session")
+
+// ErrInvalidCookie is returned by New when the cookie, or the token in token
+// mode, can't be decoded, e.g. because it was tampered with or signed by a
+// key pair no longer in use. The session returned is a fresh one. The error
+// returned wraps the one of securecookie.
+var ErrInvalidCookie = errors.New("redisstore: invalid session cookie")
+
+// ErrStoreClosed is returned when sessions are loaded or saved after Close.
+var ErrStoreClosed = errors.New("redisstore: store is closed")
+
+// ErrRedisUnavailable is returned when a redis command fails. The error
+// returned wraps the one of the redis client.
+var ErrRedisUnavailable = errors.New("redisstore: redis unavailable")
+
+// ErrValueTooLong is matched with errors.Is by the ErrSessionTooBig errors
+// returned by Save, for callers that don't need the sizes.
+var ErrValueTooLong = errors.New("SessionStore: the value to store is too big")
+
+// ErrSessionTooBig is returned by Save when the serialized session is
+// larger than the configured max length. It matches ErrValueTooLong.
+type ErrSessionTooBig struct {
+	Size  int // serialized size of the session
+	Limit int // configured max length
+}
+
+func (e *ErrSessionTooBig) Error() string {
+	return fmt.Sprintf("%v (%d bytes, limit %d)", ErrValueTooLong, e.Size, e.Limit)
+}
+
+func (e *ErrSessionTooBig) Is(target error) bool {
+	return target == ErrValueTooLong
+}
+
+// ErrTooManySessions is returned by Save when a new session would exceed the
+// session limit of its user with the RejectNewLogin policy.
+type ErrTooManySessions struct {
+	UserID string // user the session belongs to
+	Limit  int    // configured max sessions per user
+}
+
+func (e *ErrTooManySessions) Error() string {
+	return fmt.Sprintf("redisstore: user %q already has %d sessions", e.UserID, e.Limit)
+}
+
+// ErrIDCollision is returned by Save when every ID generated for a new
+// session was already taken in redis, and by RegenerateID when every new ID
+// was.
+type ErrIDCollision struct {
+	Attempts int // number of IDs tried
+}
+
+func (e *ErrIDCollision) Error() string {
+	return fmt.Sprintf("redisstore: no free session ID after %d attempts", e.Attempts)
+}
+
+// wrappedError matches sentinel with errors.Is and unwraps to err.
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *wrappedError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+func (e *wrappedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// unavailable wraps err, returned by the redis client, in ErrRedisUnavailable.
+func unavailable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &wrappedError{ErrRedisUnavailable, err}
+}
+
+// invalidCookie wraps err, returned by securecookie, in ErrInvalidCookie.
+func invalidCookie(err error) error {
+	return &wrappedError{ErrInvalidCookie, err}
+}
+
+// decodeFailed wraps err in ErrDecodeFailed.
+func decodeFailed(err error) error {
+	return &wrappedError{ErrDecodeFailed, err}
+}
+
+// serializeFailed wraps err, returned by the serializer for the session id.
+func serializeFailed(id string, err error) error {
+	return fmt.Errorf("redisstore: serialize session %q: %w", id, err)
+}
+
+// deserializeFailed wraps err, returned by the serializer for the session
+// id, in ErrDecodeFailed.
+func deserializeFailed(id string, err error) error {
+	return decodeFailed(fmt.Errorf("deserialize session %q: %w", id, err))
+}
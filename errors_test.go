@@ -0,0 +1,180 @@
+package redisstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestErrors(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+
+	store.StrictDecode = true
+	mr.Set(session.ID, "corrupted")
+	_, err := store.Get(req2, sessionName)
+	if !errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("expected ErrDecodeFailed, got %v", err)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Errorf("expected ErrDecodeFailed to wrap the serializer error")
+	}
+	s, _ := store.New(req2, sessionName)
+	if !s.IsNew || s.ID != "" || len(s.Values) != 0 {
+		t.Errorf("expected a new session without the ID of the corrupt one, got %q %v", s.ID, s.Values)
+	}
+	if err := store.Save(req2, httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := mr.Get(session.ID); stored != "corrupted" || s.ID == session.ID {
+		t.Error("expected saving the new session to keep the corrupt record")
+	}
+
+	session.Values["key"] = strings.Repeat("x", 8192)
+	var tooBig *ErrSessionTooBig
+	err = store.Save(req, httptest.NewRecorder(), session)
+	if !errors.As(err, &tooBig) || tooBig.Size <= tooBig.Limit || tooBig.Limit != 4096 {
+		t.Errorf("expected ErrSessionTooBig with the sizes, got %v", err)
+	}
+	if !errors.Is(err, ErrValueTooLong) || !strings.HasPrefix(err.Error(), "SessionStore: the value to store is too big") {
+		t.Errorf("expected the error to match ErrValueTooLong, got %v", err)
+	}
+
+	mr.Del(session.ID)
+	if err := store.Touch(session); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	mr.Close()
+	if _, err := store.New(req2, sessionName); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable from Get, got %v", err)
+	}
+	delete(session.Values, "key")
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable from Save, got %v", err)
+	}
+	if _, err := store.Delete(session.ID); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable from Delete, got %v", err)
+	}
+}
+
+func TestCorruptSession(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	var corruptID string
+	var corruptErr error
+	store.OnCorruptSession = func(id string, err error) {
+		corruptID, corruptErr = id, err
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(session.ID, "garbage")
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if err != nil {
+		t.Fatalf("expected no error for a corrupt session, got %v", err)
+	}
+	if !session2.IsNew || len(session2.Values) != 0 {
+		t.Error("expected a new session")
+	}
+	if corruptID != session.ID || !errors.Is(corruptErr, ErrDecodeFailed) {
+		t.Errorf("expected hook to fire for %q, got %q (%v)", session.ID, corruptID, corruptErr)
+	}
+	if mr.Exists(session.ID) {
+		t.Error("expected corrupt key to be deleted")
+	}
+}
+
+// failingSerializer fails every call with err.
+type failingSerializer struct{ err error }
+
+func (s failingSerializer) Serialize(ss *sessions.Session) ([]byte, error) { return nil, s.err }
+
+func (s failingSerializer) Deserialize(d []byte, ss *sessions.Session) error { return s.err }
+
+func TestSerializerErrors(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.StrictDecode = true
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(session.ID, "garbage")
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	_, err := store.Get(req2, sessionName)
+	if !errors.Is(err, ErrDecodeFailed) || !strings.Contains(err.Error(), `deserialize session "`+session.ID+`"`) {
+		t.Errorf("expected a deserialize error naming the session, got %v", err)
+	}
+
+	errSerializer := errors.New("serializer failed")
+	store.SetSerializer(failingSerializer{errSerializer})
+	_, err = store.New(req2, sessionName)
+	if !errors.Is(err, ErrDecodeFailed) || !errors.Is(err, errSerializer) {
+		t.Errorf("expected the deserialize error to wrap the serializer error, got %v", err)
+	}
+	err = store.Save(req, httptest.NewRecorder(), session)
+	if !errors.Is(err, errSerializer) || !strings.Contains(err.Error(), `serialize session "`+session.ID+`"`) {
+		t.Errorf("expected a serialize error naming the session, got %v", err)
+	}
+}
+
+func TestInvalidCookie(t *testing.T) {
+	_, client := newMiniRedis(t)
+	retired := NewRedisStore(client, []byte("old-secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := retired.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := retired.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	signed := res.Result().Cookies()[0].Value
+
+	store := NewRedisStore(client, []byte("new-secret"))
+	for name, value := range map[string]string{"garbage": "garbage", "retired key": signed} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: sessionName, Value: value})
+		s, err := store.New(req, sessionName)
+		if !errors.Is(err, ErrInvalidCookie) {
+			t.Errorf("%s: expected ErrInvalidCookie, got %v", name, err)
+		}
+		if !s.IsNew || s.ID != "" || len(s.Values) != 0 {
+			t.Errorf("%s: expected a fresh session, got %q %v", name, s.ID, s.Values)
+		}
+		if err := store.Save(req, httptest.NewRecorder(), s); err != nil || s.ID == "" || s.ID == session.ID {
+			t.Errorf("%s: expected saving to issue a new ID, got %q, %v", name, s.ID, err)
+		}
+	}
+
+	rotated := NewRedisStore(client, []byte("new-secret"), nil, []byte("old-secret"), nil)
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.AddCookie(&http.Cookie{Name: sessionName, Value: signed})
+	if s, err := rotated.New(req2, sessionName); err != nil || s.Values["key"] != ok {
+		t.Errorf("expected the session with the old key kept for decoding, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package redisstore_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/zcxzcxczcx/redisstore"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Spans of the store are children of the span in the request context, here
+// started by a middleware, so the time spent in redis shows up under each
+// request. SetTracerProvider is only needed for requests without a span.
+func ExampleRedisStore_SetTracerProvider() {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(tracetest.NewInMemoryExporter()))
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	store := redisstore.NewRedisStore(client, []byte("secret"))
+	store.SetTracerProvider(tp)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		ctx, span := tp.Tracer("app").Start(c.Request.Context(), c.FullPath())
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	})
+	r.Use(sessions.Sessions("session", store))
+	r.GET("/", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("visited", true)
+		session.Save()
+		c.Status(http.StatusOK)
+	})
+	r.Run(":8080")
+}
+
+// A readiness probe failing when redis can't store sessions.
+func ExampleRedisStore_HealthCheck() {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	store := redisstore.NewRedisStore(client, []byte("secret"))
+	store.SetHealthCheck(2*time.Second, true)
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := store.HealthCheck(r.Context()); err != nil {
+			var check *redisstore.ErrHealthCheck
+			if errors.As(err, &check) && check.Auth {
+				log.Printf("session store credentials rejected: %v", err)
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	http.ListenAndServe(":8080", nil)
+}
@@ -0,0 +1,107 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// FallbackKey is the session value marking a session served from the
+// fallback store while redis was unavailable. The next Save reaching redis
+// stores the session there again and removes the mark.
+const FallbackKey = "redisstore.fallback"
+
+// fallbackSuffix is appended to the session name for the cookie of the
+// fallback store, so it doesn't clash with the one of the session ID.
+const fallbackSuffix = "_fallback"
+
+// SetFallbackStore sets a store, typically a sessions.CookieStore, keeping a
+// copy of sessions for when redis is unavailable. Save writes the session to
+// the fallback store as well as to redis. When loading a session fails with
+// ErrRedisUnavailable, New returns the copy of the fallback store instead of
+// an error, or an empty session if there is none, and Save writes sessions it
+// can't store in redis to the fallback store only. Such sessions carry the
+// FallbackKey value, and are preferred to the one in redis by New until the
+// next Save reaching redis stores them there again. Each use of the fallback
+// is logged at Warn and reported to the store metrics as an error of the
+// "fallback" operation.
+//
+// A fallback is strictly opt-in: sessions kept in cookies can't be revoked,
+// must fit in a cookie and are as old as their cookie allows, so a session
+// deleted in redis may come back from a cookie saved during an outage. The
+// fallback store sees the session name with a "_fallback" suffix. A nil
+// store, the default, disables the fallback.
+func (rs *RedisStore) SetFallbackStore(s sessions.Store) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.fallback = s
+}
+
+// loadFallback fills session from the fallback store if err, the error of
+// loading it from redis, tells redis is unavailable, or if the fallback store
+// has a session saved there during an outage. It returns the error New
+// returns, nil once the fallback is used.
+func (rs *RedisStore) loadFallback(ctx context.Context, r *http.Request, session *sessions.Session, err error) error {
+	if rs.fallback == nil {
+		return err
+	}
+	unavailable := errors.Is(err, ErrRedisUnavailable)
+	if err != nil && !unavailable {
+		return err
+	}
+	fs, ferr := rs.fallback.New(r, session.Name()+fallbackSuffix)
+	found := ferr == nil && fs != nil && !fs.IsNew
+	if !unavailable && !(found && fs.Values[FallbackKey] != nil) {
+		return err
+	}
+	if found {
+		session.Values = fs.Values
+	} else {
+		session.Values = map[interface{}]interface{}{}
+	}
+	session.Values[FallbackKey] = true
+	session.IsNew = !found
+	rs.fallenBack(ctx, "redisstore: serving session from the fallback store", session, err)
+	return nil
+}
+
+// saveFallback writes session to the fallback store only after err, the
+// error of saving it to redis, if redis is unavailable. It returns the error
+// Save returns, nil once the fallback is used.
+func (rs *RedisStore) saveFallback(ctx context.Context, w http.ResponseWriter, session *sessions.Session, err error) error {
+	if rs.fallback == nil || !errors.Is(err, ErrRedisUnavailable) {
+		return err
+	}
+	if session.Options.MaxAge >= 0 {
+		session.Values[FallbackKey] = true
+	}
+	if ferr := rs.writeFallback(w, session); ferr != nil {
+		return err
+	}
+	rs.fallenBack(ctx, "redisstore: saving session to the fallback store", session, err)
+	return nil
+}
+
+// writeFallback saves a copy of session in the fallback store, deleting it
+// there too if session is marked for deletion.
+func (rs *RedisStore) writeFallback(w http.ResponseWriter, session *sessions.Session) error {
+	fs := sessions.NewSession(rs.fallback, session.Name()+fallbackSuffix)
+	fs.Values = session.Values
+	options := *session.Options
+	fs.Options = &options
+	// The fallback stores of gorilla don't use the request to save.
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	return rs.fallback.Save(r, w, fs)
+}
+
+// fallenBack logs and measures the use of the fallback store for session
+// after err.
+func (rs *RedisStore) fallenBack(ctx context.Context, msg string, session *sessions.Session, err error) {
+	rs.log(ctx, slog.LevelWarn, msg, "name", session.Name(), "error", err)
+	if rs.metrics != nil {
+		rs.metrics.ObserveError("fallback")
+	}
+}
@@ -0,0 +1,109 @@
+package redisstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// requestWith returns a request carrying the cookies set by res.
+func requestWith(res *httptest.ResponseRecorder) *http.Request {
+	req, _ := http.NewRequest("GET", "/", nil)
+	for _, c := range res.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestFallbackStore(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetFallbackStore(sessions.NewCookieStore([]byte("fallback")))
+	metrics := &recordingMetrics{}
+	store.SetMetrics(metrics)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(res.Result().Cookies()); n != 2 {
+		t.Fatalf("expected the ID and fallback cookies, got %d", n)
+	}
+	id := session.ID
+
+	// redis goes down, the session comes from the fallback cookie
+	mr.Close()
+	offline, err := store.New(requestWith(res), sessionName)
+	if err != nil {
+		t.Fatalf("expected the fallback session, got %v", err)
+	}
+	if offline.IsNew || offline.Values["key"] != ok || offline.Values[FallbackKey] != true {
+		t.Fatalf("expected the marked fallback session, got %v", offline.Values)
+	}
+	offline.Values["key"] = "offline"
+	res2 := httptest.NewRecorder()
+	if err := store.Save(req, res2, offline); err != nil {
+		t.Fatalf("expected the save to fall back, got %v", err)
+	}
+	fallbacks := 0
+	for _, e := range metrics.events {
+		if e == "error fallback" {
+			fallbacks++
+		}
+	}
+	if fallbacks != 2 {
+		t.Errorf("expected 2 fallbacks measured, got %v", metrics.events)
+	}
+
+	// redis is back, the session saved offline wins and is re-synced
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	req3 := requestWith(res2) // the fallback cookie only
+	for _, c := range res.Result().Cookies() {
+		if c.Name == sessionName {
+			req3.AddCookie(c)
+		}
+	}
+	resynced, err := store.New(req3, sessionName)
+	if err != nil || resynced.Values["key"] != "offline" || resynced.Values[FallbackKey] != true {
+		t.Fatalf("expected the session saved offline, got %v, %v", resynced.Values, err)
+	}
+	res3 := httptest.NewRecorder()
+	if err := store.Save(req3, res3, resynced); err != nil {
+		t.Fatal(err)
+	}
+	if resynced.ID != id {
+		t.Errorf("expected the session ID to be kept, got %q", resynced.ID)
+	}
+	online, err := store.New(requestWith(res3), sessionName)
+	if err != nil || online.Values["key"] != "offline" || online.Values[FallbackKey] != nil {
+		t.Errorf("expected the re-synced session from redis, got %v, %v", online.Values, err)
+	}
+}
+
+func TestFallbackStoreDisabled(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.Close()
+	session, err := store.New(requestWith(res), sessionName)
+	if !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable without a fallback, got %v", err)
+	}
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable on save without a fallback, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package redisstore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// fingerprintKey is the session value recording the fingerprint of the client
+// a session was created for, kept in redis when a fingerprint is set. It is
+// removed from the values returned by New.
+const fingerprintKey = "redisstore.fingerprint"
+
+// SetFingerprint binds sessions to the client they were created for, to
+// resist replaying a stolen cookie from another browser or network: fn
+// computes the fingerprint of the client of a request, e.g. with
+// UserAgentFingerprint, which is recorded in new sessions when saved. A session
+// loaded for a request with another fingerprint is treated as not found, and
+// OnFingerprintMismatch is called; New returns a fresh session, and the
+// original one is left untouched for its client. Sessions saved without a
+// fingerprint are bound when saved again. A nil fn, the default, disables the
+// check.
+func (rs *RedisStore) SetFingerprint(fn func(r *http.Request) string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.fingerprint = fn
+}
+
+// UserAgentFingerprint returns a fingerprint for SetFingerprint hashing the
+// User-Agent of requests and the network of the client, the address returned
+// by clientIP masked to its first ipv4Bits or ipv6Bits, e.g. 24 and 48, to
+// allow for some address changes. clientIP must return the address of the
+// client as seen by the application, e.g. from a header set by a trusted
+// proxy, rather than RemoteAddr blindly; a nil clientIP, or addresses it
+// fails to parse, leave the network out.
+func UserAgentFingerprint(clientIP func(r *http.Request) string, ipv4Bits, ipv6Bits int) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		h := sha256.New()
+		h.Write([]byte(r.UserAgent()))
+		var ip net.IP
+		if clientIP != nil {
+			ip = net.ParseIP(clientIP(r))
+		}
+		switch {
+		case ip == nil: // unknown network
+		case ip.To4() != nil:
+			h.Write([]byte{0, 4})
+			h.Write(ip.To4().Mask(net.CIDRMask(ipv4Bits, 32)))
+		default:
+			h.Write([]byte{0, 6})
+			h.Write(ip.Mask(net.CIDRMask(ipv6Bits, 128)))
+		}
+		return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+	}
+}
+
+// checkFingerprint reports whether the session loaded for r, in state st,
+// belongs to the client of r, and binds st to that client.
+func (rs *RedisStore) checkFingerprint(r *http.Request, session *sessions.Session, st *sessionState) bool {
+	if rs.fingerprint == nil {
+		return true
+	}
+	got, want := rs.fingerprint(r), st.fingerprint
+	if want == "" || want == got {
+		st.fingerprint = got
+		return true
+	}
+	rs.log(r.Context(), slog.LevelWarn, "redisstore: session fingerprint mismatch", "id", session.ID)
+	if rs.OnFingerprintMismatch != nil {
+		rs.OnFingerprintMismatch(session.ID, got, want)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetFingerprint(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	clientIP := func(r *http.Request) string { return r.Header.Get("X-Real-IP") }
+	store.SetFingerprint(UserAgentFingerprint(clientIP, 24, 48))
+	var mismatches []string
+	store.OnFingerprintMismatch = func(id, got, want string) {
+		if got == want {
+			t.Error("expected different fingerprints")
+		}
+		mismatches = append(mismatches, id)
+	}
+	request := func(res *httptest.ResponseRecorder, userAgent, ip string) *http.Request {
+		req := requestWith(res)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-Real-IP", ip)
+		return req
+	}
+
+	req := request(httptest.NewRecorder(), "browser", "192.0.2.10")
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.New(request(res, "browser", "192.0.2.99"), sessionName)
+	if err != nil || s.IsNew || s.Values["key"] != ok || len(s.Values) != 1 {
+		t.Fatalf("expected the session from the same browser and network, got %v %v", s.Values, err)
+	}
+	for _, replay := range []*http.Request{
+		request(res, "attacker", "192.0.2.10"),
+		request(res, "browser", "198.51.100.10"),
+	} {
+		s, err := store.New(replay, sessionName)
+		if err != nil || !s.IsNew || s.ID != "" || len(s.Values) != 0 {
+			t.Errorf("expected a replayed cookie to get a new session, got %q %v %v", s.ID, s.Values, err)
+		}
+	}
+	if len(mismatches) != 2 || mismatches[0] != session.ID {
+		t.Errorf("expected the mismatches to be reported, got %v", mismatches)
+	}
+	if !mr.Exists(session.ID) {
+		t.Error("expected the session to be kept for its client")
+	}
+
+	// sessions saved before fingerprints were enabled are bound on save
+	store.SetFingerprint(nil)
+	req = request(httptest.NewRecorder(), "browser", "192.0.2.10")
+	legacy, _ := store.New(req, sessionName)
+	res = httptest.NewRecorder()
+	if err := store.Save(req, res, legacy); err != nil {
+		t.Fatal(err)
+	}
+	store.SetFingerprint(UserAgentFingerprint(nil, 0, 0))
+	s, _ = store.New(request(res, "other", ""), sessionName)
+	if s.IsNew {
+		t.Fatal("expected a session without a fingerprint to be accepted")
+	}
+	if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.New(request(res, "browser", ""), sessionName); !s.IsNew {
+		t.Error("expected the session to be bound once saved")
+	}
+}
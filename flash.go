@@ -0,0 +1,41 @@
+package redisstore
+
+import (
+	"encoding/gob"
+
+	"github.com/gorilla/sessions"
+)
+
+// flashesKey is the session value gorilla/sessions keeps flashes under when
+// AddFlash and Flashes are called without a key.
+const flashesKey = "_flash"
+
+func init() {
+	RegisterFlashTypes()
+}
+
+// RegisterFlashTypes registers with gob the types of flash messages, which
+// GobSerializer can't save otherwise: the list of flashes of
+// gorilla/sessions and basic types like strings are registered by default,
+// other types, e.g. a struct, must be registered with a value of the type
+// before flashes of that type are saved. JSONSerializer and
+// MsgpackSerializer need no registration, but flashes must be representable
+// in their format, and are read back as its generic types, e.g. float64 for
+// JSON numbers and maps for structs.
+func RegisterFlashTypes(values ...interface{}) {
+	gob.Register([]interface{}{})
+	for _, v := range values {
+		gob.Register(v)
+	}
+}
+
+// dropFlashes removes an empty flash list set in the values of session, so
+// it doesn't force a rewrite of an otherwise unchanged session, see
+// SetResaveUnchanged. Only the default flash key is handled; flashes added
+// under a custom key are kept as set. Flashes read with Flashes are already
+// removed from the values by gorilla/sessions.
+func dropFlashes(session *sessions.Session) {
+	if flashes, ok := session.Values[flashesKey].([]interface{}); ok && len(flashes) == 0 {
+		delete(session.Values, flashesKey)
+	}
+}
@@ -0,0 +1,102 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlashes(t *testing.T) {
+	for name, serializer := range map[string]SessionSerializer{"gob": GobSerializer{}, "json": JSONSerializer{}} {
+		t.Run(name, func(t *testing.T) {
+			_, client := newMiniRedis(t)
+			store := NewRedisStore(client, []byte("secret"))
+			store.SetSerializer(serializer)
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.New(req, sessionName)
+			session.AddFlash("saved")
+			res := httptest.NewRecorder()
+			if err := store.Save(req, res, session); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := store.New(requestWith(res), sessionName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flashes := s.Flashes(); len(flashes) != 1 || flashes[0] != "saved" {
+				t.Fatalf("expected the flash of the previous request, got %v", flashes)
+			}
+			if err := store.Save(requestWith(res), httptest.NewRecorder(), s); err != nil {
+				t.Fatal(err)
+			}
+			if s, _ := store.New(requestWith(res), sessionName); len(s.Flashes()) != 0 {
+				t.Error("expected reading flashes to consume them")
+			}
+		})
+	}
+}
+
+func TestFlashesUnchanged(t *testing.T) {
+	_, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetResaveUnchanged(false)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	for k := range counts {
+		delete(counts, k)
+	}
+
+	s, _ := store.New(requestWith(res), sessionName)
+	s.AddFlash("shown")
+	s.Flashes()
+	if err := store.Save(requestWith(res), httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = store.New(requestWith(res), sessionName)
+	s.Values[flashesKey] = []interface{}{}
+	if err := store.Save(requestWith(res), httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 0 {
+		t.Errorf("expected consumed flashes not to rewrite the session, got %v", counts)
+	}
+	if _, found := s.Values[flashesKey]; found {
+		t.Error("expected the empty flash list to be dropped")
+	}
+}
+
+// notice is a flash type registered with RegisterFlashTypes.
+type notice struct {
+	Level, Text string
+}
+
+func TestRegisterFlashTypes(t *testing.T) {
+	RegisterFlashTypes(notice{})
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetSerializer(GobSerializer{})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.AddFlash(notice{"info", "saved"})
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.New(requestWith(res), sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flashes := s.Flashes(); len(flashes) != 1 || flashes[0] != (notice{"info", "saved"}) {
+		t.Errorf("expected the registered flash type to be reloaded, got %#v", flashes)
+	}
+}
@@ -0,0 +1,230 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// StorageMode is the layout of sessions in redis.
+type StorageMode int
+
+const (
+	// BlobMode stores each session as a single serialized string value.
+	BlobMode StorageMode = iota
+	// HashMode stores each session as a hash with one field per session
+	// value, so single values can be read and written with GetField and
+	// SetField. Session keys must be non-empty strings.
+	HashMode
+)
+
+// hashMarker is a field always present in session hashes, so that sessions
+// without values still exist in redis.
+const hashMarker = ""
+
+// Script setting a field of an existing hash, without changing its TTL.
+const hsetIfExistsScript = `if redis.call("EXISTS", KEYS[1]) == 0 then return 0 end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1`
+
+// hashClient is implemented by clients supporting HashMode.
+type hashClient interface {
+	// HSet replaces the hash key with fields, expiring after ttl if ttl is
+	// positive.
+	HSet(ctx context.Context, key string, fields map[string][]byte, ttl time.Duration) error
+	// HGetAll returns the fields of the hash key, or an empty map if key
+	// does not exist.
+	HGetAll(ctx context.Context, key string) (map[string][]byte, error)
+	// HGet returns a field of the hash key, or ErrNil if it does not exist.
+	HGet(ctx context.Context, key, field string) ([]byte, error)
+	// HSetIfExists sets a field of the hash key and reports whether key
+	// exists; nothing is written if it does not.
+	HSetIfExists(ctx context.Context, key, field string, value []byte) (bool, error)
+}
+
+// SetStorageMode sets how sessions are laid out in redis. Sessions saved in
+// one mode can't be read in the other. In HashMode, SetResaveUnchanged has
+// no effect and the max length applies to each value.
+func (rs *RedisStore) SetStorageMode(m StorageMode) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.storage = m
+}
+
+// hashes returns the client of the store as a hashClient.
+func (rs *RedisStore) hashes() (hashClient, error) {
+	h, ok := rs.client().(hashClient)
+	if !ok {
+		return nil, errors.New("redisstore: client does not support hash storage")
+	}
+	return h, nil
+}
+
+// GetField returns the value field of the session id, loading only that
+// value. It returns ErrSessionNotFound if the session does not exist and a
+// nil value if the session has no such field. The store must be in HashMode.
+func (rs *RedisStore) GetField(ctx context.Context, id, field string) (interface{}, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	h, err := rs.fieldClient(field)
+	if err != nil {
+		return nil, err
+	}
+	data, err := h.HGet(ctx, rs.key(id), field)
+	if err == ErrNil {
+		found, err := rs.client().Exists(ctx, rs.key(id))
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		if !found {
+			return nil, ErrSessionNotFound
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	ss := sessions.NewSession(nil, "")
+	if err := rs.decodeField(id, data, ss); err != nil {
+		return nil, err
+	}
+	return ss.Values[field], nil
+}
+
+// SetField sets the value field of the session id, writing only that value
+// and keeping the TTL of the session. It returns ErrSessionNotFound if the
+// session does not exist. The store must be in HashMode.
+func (rs *RedisStore) SetField(ctx context.Context, id, field string, value interface{}) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if err := rs.writable(ctx); err != nil {
+		return err
+	}
+	h, err := rs.fieldClient(field)
+	if err != nil {
+		return err
+	}
+	b, err := rs.encodeField(id, field, value)
+	if err != nil {
+		return err
+	}
+	found, err := h.HSetIfExists(ctx, rs.key(id), field, b)
+	if err != nil {
+		return unavailable(err)
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
+	rs.observe().OnSave(id, len(b))
+	return nil
+}
+
+// fieldClient checks that GetField and SetField can be used with field.
+func (rs *RedisStore) fieldClient(field string) (hashClient, error) {
+	if err := rs.requireMode(HashMode, "field access"); err != nil {
+		return nil, err
+	}
+	if field == hashMarker {
+		return nil, errors.New("redisstore: empty field name")
+	}
+	return rs.hashes()
+}
+
+// requireMode checks that the store is in mode, which feature requires.
+func (rs *RedisStore) requireMode(mode StorageMode, feature string) error {
+	if rs.storage == mode {
+		return nil
+	}
+	name := "BlobMode"
+	if mode == HashMode {
+		name = "HashMode"
+	}
+	return fmt.Errorf("redisstore: %s requires %s", feature, name)
+}
+
+// saveHash writes the values of session to the hash of the session id and
+// returns the size of the stored values.
+func (rs *RedisStore) saveHash(ctx context.Context, id string, session *sessions.Session) (int, error) {
+	h, err := rs.hashes()
+	if err != nil {
+		return 0, err
+	}
+	fields := map[string][]byte{hashMarker: {}}
+	size := 0
+	for k, v := range session.Values {
+		field, ok := k.(string)
+		if !ok || field == hashMarker {
+			return 0, fmt.Errorf("redisstore: key %#v not supported in hash storage", k)
+		}
+		b, err := rs.encodeField(id, field, v)
+		if err != nil {
+			return 0, err
+		}
+		fields[field] = b
+		size += len(b)
+	}
+	if err := h.HSet(ctx, rs.key(id), fields, rs.ttl(session)); err != nil {
+		return 0, unavailable(err)
+	}
+	rs.written(session)
+	return size, nil
+}
+
+// loadHash reads the values of session from its hash and reports whether
+// the session was found.
+func (rs *RedisStore) loadHash(ctx context.Context, session *sessions.Session) (bool, error) {
+	h, err := rs.hashes()
+	if err != nil {
+		return false, err
+	}
+	fields, err := h.HGetAll(ctx, rs.key(session.ID))
+	if err != nil {
+		return false, unavailable(err)
+	}
+	found := len(fields) > 0
+	rs.observe().OnLoad(session.ID, found)
+	if !found {
+		return false, nil
+	}
+	size := 0
+	for field, data := range fields {
+		size += len(data)
+		if field == hashMarker {
+			continue
+		}
+		if err := rs.decodeField(session.ID, data, session); err != nil {
+			return true, err
+		}
+	}
+	spanSize(ctx, size)
+	return true, nil
+}
+
+// encodeField serializes a single value of the session id.
+func (rs *RedisStore) encodeField(id, field string, value interface{}) ([]byte, error) {
+	ss := sessions.NewSession(nil, "")
+	ss.Values[field] = value
+	return rs.serialize(id, ss)
+}
+
+// decodeField deserializes a value of the session id encoded by encodeField
+// into session.
+func (rs *RedisStore) decodeField(id string, data []byte, session *sessions.Session) error {
+	b, err := rs.decode(data)
+	if err != nil {
+		return decodeFailed(err)
+	}
+	if err := rs.serializer.Deserialize(b, session); err != nil {
+		return deserializeFailed(id, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHashMode(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetStorageMode(HashMode)
+			testStore(t, mr, store)
+		})
+	}
+}
+
+func TestHashModeFields(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetStorageMode(HashMode)
+			ctx := context.Background()
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(req, sessionName)
+			session.Values["key"] = ok
+			session.Values["count"] = 1
+			res := httptest.NewRecorder()
+			if err := store.Save(req, res, session); err != nil {
+				t.Fatal(err)
+			}
+			if !mr.Exists(session.ID) || mr.Type(session.ID) != "hash" {
+				t.Fatal("expected session to be stored as a hash")
+			}
+			if mr.TTL(session.ID) != time.Duration(sessionExpire)*time.Second {
+				t.Errorf("expected TTL on the hash, got %v", mr.TTL(session.ID))
+			}
+
+			if v, err := store.GetField(ctx, session.ID, "count"); err != nil || v != 1 {
+				t.Errorf("expected field to load, got %v, %v", v, err)
+			}
+			if v, err := store.GetField(ctx, session.ID, "missing"); err != nil || v != nil {
+				t.Errorf("expected nil for a missing field, got %v, %v", v, err)
+			}
+			mr.FastForward(time.Hour)
+			if err := store.SetField(ctx, session.ID, "count", 2); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SetField(ctx, session.ID, "other", "value"); err != nil {
+				t.Fatal(err)
+			}
+			if mr.TTL(session.ID) != time.Duration(sessionExpire)*time.Second-time.Hour {
+				t.Errorf("expected SetField to keep the TTL, got %v", mr.TTL(session.ID))
+			}
+
+			req2, _ := http.NewRequest("GET", "/", nil)
+			req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+			session2, err := store.Get(req2, sessionName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(session2.Values) != 3 || session2.Values["key"] != ok || session2.Values["count"] != 2 || session2.Values["other"] != "value" {
+				t.Errorf("expected full load to see field updates, got %v", session2.Values)
+			}
+
+			delete(session2.Values, "other")
+			if err := store.Save(req2, httptest.NewRecorder(), session2); err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := store.GetField(ctx, session.ID, "other"); v != nil {
+				t.Error("expected Save to remove deleted values")
+			}
+
+			store.Delete(session.ID)
+			if _, err := store.GetField(ctx, session.ID, "key"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+			if err := store.SetField(ctx, session.ID, "key", ok); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+			if mr.Exists(session.ID) {
+				t.Error("expected SetField not to create a session")
+			}
+		})
+	}
+}
+
+func TestHashModeErrors(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	ctx := context.Background()
+	if _, err := store.GetField(ctx, "id", "key"); err == nil {
+		t.Error("expected error for field access in blob mode")
+	}
+
+	store.SetStorageMode(HashMode)
+	if err := store.SetField(ctx, "id", "", ok); err == nil {
+		t.Error("expected error for an empty field name")
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values[1] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Error("expected error for a non-string key")
+	}
+}
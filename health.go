@@ -0,0 +1,103 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrHealthCheck is returned by HealthCheck when a step of the check fails.
+// It wraps the error of the step, which wraps ErrRedisUnavailable for redis
+// errors.
+type ErrHealthCheck struct {
+	Step string // "ping", "set", "get" or "del"
+	Auth bool   // redis rejected the credentials of the client
+	Err  error
+}
+
+func (e *ErrHealthCheck) Error() string {
+	if e.Auth {
+		return fmt.Sprintf("redisstore: health check %s: authentication failed: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("redisstore: health check %s: %v", e.Step, e.Err)
+}
+
+func (e *ErrHealthCheck) Unwrap() error {
+	return e.Err
+}
+
+// healthPrefix follows the key prefix in the keys of health check probes.
+const healthPrefix = "healthcheck:"
+
+// SetHealthCheck configures HealthCheck. A positive timeout bounds each
+// check, in addition to the deadline of its context. With probe, the check
+// also writes, reads back and deletes a probe key under the key prefix, to
+// detect a redis that answers pings but can't store sessions, e.g. a read
+// only replica or one out of memory. Read-only stores skip the probe.
+func (rs *RedisStore) SetHealthCheck(timeout time.Duration, probe bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.healthTimeout, rs.healthProbe = timeout, probe
+}
+
+// HealthCheck checks that the store can use redis, e.g. for readiness
+// probes: it pings redis and, if configured with SetHealthCheck, runs a SET,
+// GET and DEL round trip on a probe key. The error returned is an
+// *ErrHealthCheck, or ErrStoreClosed once the store is closed.
+func (rs *RedisStore) HealthCheck(ctx context.Context) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if rs.healthTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rs.healthTimeout)
+		defer cancel()
+	}
+	if err := rs.ping(ctx); err != nil {
+		return healthCheckFailed("ping", err)
+	}
+	if !rs.healthProbe || rs.readOnly {
+		return nil
+	}
+	value, err := randomID(minIDLength).Generate()
+	if err != nil {
+		return healthCheckFailed("set", err)
+	}
+	key := rs.keyPrefix + healthPrefix + value
+	if err := rs.client().Set(ctx, key, []byte(value), time.Minute); err != nil {
+		return healthCheckFailed("set", unavailable(err))
+	}
+	got, err := rs.client().Get(ctx, key)
+	if err == nil && string(got) != value {
+		err = errors.New("probe key read back a different value")
+	}
+	if err != nil {
+		return healthCheckFailed("get", unavailable(err))
+	}
+	if _, err := rs.client().Del(ctx, key); err != nil {
+		return healthCheckFailed("del", unavailable(err))
+	}
+	return nil
+}
+
+// healthCheckFailed returns the error of HealthCheck for err, the error of
+// step.
+func healthCheckFailed(step string, err error) error {
+	return &ErrHealthCheck{Step: step, Auth: authFailed(err), Err: err}
+}
+
+// authFailed reports whether err is a redis error rejecting the credentials
+// of the client.
+func authFailed(err error) bool {
+	msg := err.Error()
+	for _, reply := range []string{"NOAUTH ", "WRONGPASS ", "ERR invalid password", "ERR AUTH "} {
+		if strings.Contains(msg, reply) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHealthCheck(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetKeyPrefix("session:")
+	if err := store.HealthCheck(context.Background()); err != nil || counts["set"] != 0 {
+		t.Errorf("expected a ping only, got %v and %v", err, counts)
+	}
+
+	store.SetHealthCheck(time.Second, true)
+	if err := store.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 1 || counts["get"] != 1 || counts["del"] != 1 {
+		t.Errorf("expected a probe round trip, got %v", counts)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected the probe key to be deleted, got %v", keys)
+	}
+	mr.Set("session:"+healthPrefix+"probe", "probe")
+	if ids, err := store.ListSessionIDs(context.Background()); err != nil || len(ids) != 0 {
+		t.Errorf("expected probe keys not to be listed as sessions, got %v, %v", ids, err)
+	}
+	mr.Del("session:" + healthPrefix + "probe")
+
+	mr.Close()
+	err := store.HealthCheck(context.Background())
+	var check *ErrHealthCheck
+	if !errors.As(err, &check) || check.Step != "ping" || check.Auth || !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected the ping to fail with redis unavailable, got %v", err)
+	}
+	store.Close()
+	if err := store.HealthCheck(context.Background()); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed after Close, got %v", err)
+	}
+}
+
+func TestHealthCheckAuth(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	mr.RequireAuth("password")
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisStore(client, []byte("secret"))
+
+	err := store.HealthCheck(context.Background())
+	var check *ErrHealthCheck
+	if !errors.As(err, &check) || !check.Auth {
+		t.Errorf("expected an authentication failure, got %v", err)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.cmd = newHangingClient(t)
+	store.SetHealthCheck(50*time.Millisecond, false)
+	start := time.Now()
+	if err := store.HealthCheck(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the timeout to stop the check, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the check to return promptly, took %v", elapsed)
+	}
+}
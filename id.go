@@ -0,0 +1,316 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// IDGenerator generates the IDs of new sessions.
+type IDGenerator interface {
+	// Generate returns a new session ID, or an error if none can be made,
+	// e.g. when the source of randomness fails.
+	Generate() (string, error)
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator.
+type IDGeneratorFunc func() (string, error)
+
+// Generate calls f.
+func (f IDGeneratorFunc) Generate() (string, error) {
+	return f()
+}
+
+// Base64IDGenerator generates IDs of Length random bytes, 32 if zero,
+// encoded in URL-safe base64 without padding. Lengths below 16 bytes are
+// rejected.
+type Base64IDGenerator struct {
+	Length int
+}
+
+// Generate returns a new random ID.
+func (g Base64IDGenerator) Generate() (string, error) {
+	b, err := randomBytes(g.Length)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// UUIDGenerator generates random (version 4) UUIDs, in their canonical
+// lowercase form.
+type UUIDGenerator struct{}
+
+// Generate returns a new UUID.
+func (UUIDGenerator) Generate() (string, error) {
+	b := generateRandomKey(16)
+	if len(b) < 16 {
+		return "", errRandom
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// PrefixedIDGenerator prepends Prefix to the IDs of Inner, e.g. to tell
+// apart sessions of different environments. A nil Inner means the default
+// generator. Like generated IDs, Prefix can't have colons, see
+// SetIDGenerator.
+type PrefixedIDGenerator struct {
+	Prefix string
+	Inner  IDGenerator
+}
+
+// Generate returns a new ID of Inner with Prefix.
+func (g PrefixedIDGenerator) Generate() (string, error) {
+	inner := g.Inner
+	if inner == nil {
+		inner = randomID(0)
+	}
+	id, err := inner.Generate()
+	if err != nil {
+		return "", err
+	}
+	return g.Prefix + id, nil
+}
+
+// Default and minimum number of random bytes of session IDs.
+const (
+	defaultIDLength = 32
+	minIDLength     = 16
+)
+
+// Source of the random bytes of session IDs, replaced by tests.
+var generateRandomKey = securecookie.GenerateRandomKey
+
+// Error of generators failing to read random bytes.
+var errRandom = errors.New("redisstore: failed to generate random session ID")
+
+// randomID is the default IDGenerator, encoding n random bytes in base32.
+type randomID int
+
+func (n randomID) Generate() (string, error) {
+	b, err := randomBytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="), nil
+}
+
+// randomBytes returns n random bytes for an ID, defaultIDLength if n is zero.
+func randomBytes(n int) ([]byte, error) {
+	if n == 0 {
+		n = defaultIDLength
+	}
+	if n < minIDLength {
+		return nil, fmt.Errorf("redisstore: session ID length must be at least %d bytes, got %d", minIDLength, n)
+	}
+	b := generateRandomKey(n)
+	if len(b) < n {
+		return nil, errRandom
+	}
+	return b, nil
+}
+
+// SetIDLength sets the number of random bytes of the IDs generated by the
+// default generator, 32 by default. It must be at least 16.
+func (rs *RedisStore) SetIDLength(n int) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if n < minIDLength {
+		return fmt.Errorf("redisstore: session ID length must be at least %d bytes, got %d", minIDLength, n)
+	}
+	rs.idLength = n
+	return nil
+}
+
+// IDEncoding is the encoding of the random bytes of the IDs generated by
+// the default generator.
+type IDEncoding int
+
+const (
+	// Base32Encoding encodes IDs in standard base32 without padding, 52
+	// characters for 32 bytes.
+	Base32Encoding IDEncoding = iota
+	// Base64URLEncoding encodes IDs in URL-safe base64 without padding, 43
+	// characters for 32 bytes.
+	Base64URLEncoding
+)
+
+// SetIDEncoding sets the encoding of the IDs generated by the default
+// generator, Base32Encoding by default. Only new IDs are affected: IDs are
+// opaque, so existing sessions load whatever their encoding.
+func (rs *RedisStore) SetIDEncoding(e IDEncoding) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if e != Base32Encoding && e != Base64URLEncoding {
+		return fmt.Errorf("redisstore: unknown ID encoding %d", e)
+	}
+	rs.idEncoding = e
+	return nil
+}
+
+// SetIDGenerator sets the generator of the IDs of new sessions, called by
+// Save for sessions without an ID. It defaults to random bytes encoded in
+// base32, see SetIDLength and SetIDEncoding; a nil generator restores the
+// default. Generated IDs are used verbatim in redis keys, and must be
+// non-empty and only have characters allowed in cookies, without colons:
+// keys such as "user:x", "tag:x" or "x:lock" are the user indexes, tag sets
+// and locks kept next to the sessions.
+func (rs *RedisStore) SetIDGenerator(gen IDGenerator) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.newID = gen
+}
+
+// generateID returns an ID for a new session.
+func (rs *RedisStore) generateID() (string, error) {
+	gen := rs.newID
+	switch {
+	case gen != nil:
+	case rs.idEncoding == Base64URLEncoding:
+		gen = Base64IDGenerator{rs.idLength}
+	default:
+		gen = randomID(rs.idLength)
+	}
+	id, err := gen.Generate()
+	if err != nil {
+		return "", err
+	}
+	if err := validID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// validID checks that id is not empty and only has characters allowed in
+// cookie values: printable ASCII except double quotes, commas, semicolons
+// and backslashes. Colons are rejected too, so session keys are never taken
+// for the auxiliary keys of the store.
+func validID(id string) error {
+	if id == "" {
+		return errors.New("redisstore: generated session ID is empty")
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c <= ' ' || c > '~' || c == '"' || c == ',' || c == ';' || c == '\\' || c == ':' {
+			return fmt.Errorf("redisstore: generated session ID %q has invalid character %q", id, c)
+		}
+	}
+	return nil
+}
+
+// Number of IDs tried for a new session before Save gives up.
+const idAttempts = 3
+
+// errIDTaken is returned by save when the ID of a new session is already
+// used in redis.
+var errIDTaken = errors.New("redisstore: session ID already taken")
+
+// setNXClient is implemented by clients able to set keys that don't exist.
+type setNXClient interface {
+	// SetNX sets key to value, expiring after ttl if ttl is positive, if key
+	// does not exist. It reports whether key was set.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// Script setting KEYS[1] to ARGV[1] with a TTL of ARGV[2] milliseconds if it
+// does not exist, and deleting KEYS[2] once it is set.
+const setNXDelScript = `local set
+if tonumber(ARGV[2]) > 0 then
+	set = redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2], "NX")
+else
+	set = redis.call("SET", KEYS[1], ARGV[1], "NX")
+end
+if not set then
+	return 0
+end
+redis.call("DEL", KEYS[2])
+return 1`
+
+// setNXDeler is implemented by clients able to move a session to a new key
+// that doesn't exist in a single step.
+type setNXDeler interface {
+	// SetNXDel atomically sets key to value, expiring after ttl if ttl is
+	// positive, if key does not exist, and then deletes oldKey. It reports
+	// whether key was set.
+	SetNXDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) (bool, error)
+}
+
+// create saves session, which has no ID yet, under a new ID, generating
+// another one while the ID is taken in redis. On errors session is left
+// without an ID, so it is still new to later saves.
+func (rs *RedisStore) create(ctx context.Context, session *sessions.Session) error {
+	for i := 0; i < idAttempts; i++ {
+		id, err := rs.generateID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+		err = rs.save(ctx, session, true)
+		if err == nil {
+			return nil
+		}
+		session.ID = ""
+		if err != errIDTaken {
+			return err
+		}
+	}
+	return &ErrIDCollision{Attempts: idAttempts}
+}
+
+// regenerate moves session to a new ID, generating another one while the ID
+// is taken in redis, and returns the new ID and the size of the stored data.
+// session keeps its ID.
+func (rs *RedisStore) regenerate(ctx context.Context, session *sessions.Session) (string, int, error) {
+	for i := 0; i < idAttempts; i++ {
+		id, err := rs.generateID()
+		if err != nil {
+			return "", 0, err
+		}
+		size, err := rs.move(ctx, session, id)
+		if err != errIDTaken {
+			return id, size, err
+		}
+	}
+	return "", 0, &ErrIDCollision{Attempts: idAttempts}
+}
+
+// setNew sets key, the key of a new session, to b, unless key exists.
+func (rs *RedisStore) setNew(ctx context.Context, key string, b []byte, ttl time.Duration) error {
+	c, ok := rs.client().(setNXClient)
+	if !ok {
+		if err := rs.taken(ctx, key); err != nil {
+			return err
+		}
+		return unavailable(rs.client().Set(ctx, key, b, ttl))
+	}
+	set, err := c.SetNX(ctx, key, b, ttl)
+	if err != nil {
+		return unavailable(err)
+	}
+	if !set {
+		return errIDTaken
+	}
+	return nil
+}
+
+// taken returns errIDTaken if key, the key of a new session, exists.
+func (rs *RedisStore) taken(ctx context.Context, key string) error {
+	found, err := rs.client().Exists(ctx, key)
+	if err != nil {
+		return unavailable(err)
+	}
+	if found {
+		return errIDTaken
+	}
+	return nil
+}
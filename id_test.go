@@ -0,0 +1,359 @@
+package redisstore
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSetIDGenerator(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetKeyPrefix("session:")
+	store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return "fixed-id", nil }))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("session:fixed-id") {
+		t.Error("expected redis key to use the generated ID")
+	}
+
+	store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return "", nil }))
+	session, _ = store.New(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Error("expected error for an empty generated ID")
+	}
+}
+
+func TestSetIDLength(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.SetIDLength(8); err == nil {
+		t.Error("expected error for a length below 16 bytes")
+	}
+
+	for _, n := range []int{defaultIDLength, 16, 48} {
+		if n != defaultIDLength {
+			if err := store.SetIDLength(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(session.ID, "=") {
+			t.Errorf("expected padding to be trimmed from %q", session.ID)
+		}
+		b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != n {
+			t.Errorf("expected %d random bytes, got %d", n, len(b))
+		}
+	}
+}
+
+func TestSetIDEncoding(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.SetIDEncoding(IDEncoding(42)); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	old, _ := store.New(req, sessionName)
+	old.Values["key"] = "base32"
+	resOld := httptest.NewRecorder()
+	if err := store.Save(req, resOld, old); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithIDEncoding(Base64URLEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = "base64"
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(session.ID)
+	if err != nil || len(b) != defaultIDLength {
+		t.Fatalf("expected %d random bytes in base64url, got %q (%v)", defaultIDLength, session.ID, err)
+	}
+	for want, res := range map[string]*httptest.ResponseRecorder{"base64": res, "base32": resOld} {
+		if s, err := store.New(requestWith(res), sessionName); err != nil || s.Values["key"] != want {
+			t.Errorf("expected the %s session to load, got %v", want, err)
+		}
+	}
+}
+
+func TestIDGeneratorError(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	failing := errors.New("no entropy")
+	store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return "", failing }))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, failing) {
+		t.Errorf("expected the generator error, got %v", err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected nothing written, got %v", keys)
+	}
+}
+
+func TestRandomKeyFailure(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	defer func(f func(int) []byte) { generateRandomKey = f }(generateRandomKey)
+	generateRandomKey = func(int) []byte { return nil }
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Error("expected error when no random bytes can be read")
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected nothing written, got %v", keys)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	tests := []struct {
+		name  string
+		gen   IDGenerator
+		check func(id string) bool
+	}{
+		{"base64url", Base64IDGenerator{Length: 16}, func(id string) bool {
+			b, err := base64.RawURLEncoding.DecodeString(id)
+			return err == nil && len(b) == 16
+		}},
+		{"base64url default", Base64IDGenerator{}, func(id string) bool {
+			b, err := base64.RawURLEncoding.DecodeString(id)
+			return err == nil && len(b) == defaultIDLength
+		}},
+		{"uuid", UUIDGenerator{}, uuid.MatchString},
+		{"prefixed", PrefixedIDGenerator{Prefix: "staging-", Inner: UUIDGenerator{}}, func(id string) bool {
+			return strings.HasPrefix(id, "staging-") && uuid.MatchString(strings.TrimPrefix(id, "staging-"))
+		}},
+	}
+	for _, tt := range tests {
+		mr, client := newMiniRedis(t)
+		store := NewRedisStore(client, []byte("secret"))
+		store.SetKeyPrefix("session:")
+		store.SetIDGenerator(tt.gen)
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !tt.check(session.ID) {
+			t.Errorf("%s: unexpected ID %q", tt.name, session.ID)
+		}
+		if !mr.Exists("session:" + session.ID) {
+			t.Errorf("%s: expected redis key to be the prefix and the ID %q", tt.name, session.ID)
+		}
+	}
+
+	if _, err := (Base64IDGenerator{Length: 8}).Generate(); err == nil {
+		t.Error("expected error for a length below 16 bytes")
+	}
+}
+
+func TestInvalidGeneratedID(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	for _, id := range []string{"with space", "semi;colon", "quote\"", "comma,", "tab\t", "caf\u00e9",
+		"user:x", "tag:x", "healthcheck:x", "x:lock"} {
+		id := id
+		store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return id, nil }))
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+			t.Errorf("expected error for ID %q", id)
+		}
+	}
+}
+
+func TestGeneratorOnlyForNewSessions(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	calls := 0
+	store.SetIDGenerator(IDGeneratorFunc(func() (string, error) {
+		calls++
+		return "generated", nil
+	}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	for i := 0; i < 2; i++ {
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session.ID = "existing"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || session.ID != "existing" {
+		t.Errorf("expected a single call and the ID to be kept, got %d calls and %q", calls, session.ID)
+	}
+}
+
+func TestIDCollision(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("taken", "existing")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			ids := []string{"taken", "free"}
+			store.SetIDGenerator(IDGeneratorFunc(func() (string, error) {
+				id := ids[0]
+				ids = ids[1:]
+				return id, nil
+			}))
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(req, sessionName)
+			session.Values["key"] = ok
+			if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+				t.Fatal(err)
+			}
+			if session.ID != "free" || !mr.Exists("free") {
+				t.Errorf("expected the session under the next ID, got %q", session.ID)
+			}
+			if v, _ := mr.Get("taken"); v != "existing" {
+				t.Errorf("expected the colliding key to be kept, got %q", v)
+			}
+
+			// re-saves overwrite the session's own key
+			session.Values["key"] = "changed"
+			if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+				t.Errorf("expected re-save to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIDCollisionAttempts(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	mr.Set("taken", "existing")
+	for _, mode := range []StorageMode{BlobMode, HashMode} {
+		store := NewRedisStore(client, []byte("secret"))
+		store.SetStorageMode(mode)
+		store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return "taken", nil }))
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		session.Values["key"] = ok
+		err := store.Save(req, httptest.NewRecorder(), session)
+		var collision *ErrIDCollision
+		if !errors.As(err, &collision) || collision.Attempts != idAttempts {
+			t.Errorf("mode %d: expected ErrIDCollision after %d attempts, got %v", mode, idAttempts, err)
+		}
+		if session.ID != "" {
+			t.Errorf("mode %d: expected no ID, got %q", mode, session.ID)
+		}
+		if v, _ := mr.Get("taken"); v != "existing" {
+			t.Errorf("mode %d: expected the colliding key to be kept, got %q", mode, v)
+		}
+	}
+}
+
+func TestRegenerateIDCollision(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	all := clients(t, mr)
+	all["basic"] = struct{ Client }{all["go-redis/v9"]} // checks with Exists
+	for name, c := range all {
+		for _, mode := range []StorageMode{BlobMode, HashMode} {
+			if _, ok := c.(hashClient); !ok && mode == HashMode {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s/%d", name, mode), func(t *testing.T) {
+				mr.FlushAll()
+				mr.Set("taken", "existing")
+				store := NewRedisStoreWithClient(c, []byte("secret"))
+				store.SetStorageMode(mode)
+				ids := []string{"old", "taken", "free"}
+				store.SetIDGenerator(IDGeneratorFunc(func() (string, error) {
+					id := ids[0]
+					ids = ids[1:]
+					return id, nil
+				}))
+
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				session.Values["key"] = ok
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.RegenerateID(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				if session.ID != "free" || !mr.Exists("free") || mr.Exists("old") {
+					t.Errorf("expected the session to move to the next ID, got %q, keys %v", session.ID, mr.Keys())
+				}
+				if v, _ := mr.Get("taken"); v != "existing" {
+					t.Errorf("expected the colliding key to be kept, got %q", v)
+				}
+
+				store.SetIDGenerator(IDGeneratorFunc(func() (string, error) { return "taken", nil }))
+				err := store.RegenerateID(req, httptest.NewRecorder(), session)
+				var collision *ErrIDCollision
+				if !errors.As(err, &collision) || collision.Attempts != idAttempts {
+					t.Errorf("expected ErrIDCollision after %d attempts, got %v", idAttempts, err)
+				}
+				if session.ID != "free" || !mr.Exists("free") {
+					t.Errorf("expected the session to keep its ID, got %q", session.ID)
+				}
+				if v, _ := mr.Get("taken"); v != "existing" {
+					t.Errorf("expected the colliding key to be kept, got %q", v)
+				}
+			})
+		}
+	}
+}
+
+func TestCreateFailureClearsID(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetMaxLength(16)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = strings.Repeat("x", 64)
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected the session to be too big, got %v", err)
+	}
+	if session.ID != "" {
+		t.Errorf("expected no ID after a failed save, got %q", session.ID)
+	}
+
+	mr.Close()
+	store.SetMaxLength(0)
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, ErrRedisUnavailable) {
+		t.Fatalf("expected redis to be unavailable, got %v", err)
+	}
+	if session.ID != "" {
+		t.Errorf("expected no ID after a failed save, got %q", session.ID)
+	}
+}
@@ -0,0 +1,145 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrSessionLocked is returned by LockSession when the session is locked by
+// someone else.
+var ErrSessionLocked = errors.New("redisstore: session is locked")
+
+// ErrLockExpired is returned when unlocking a session whose lock expired
+// first, so the session may have been locked and changed by someone else.
+var ErrLockExpired = errors.New("redisstore: session lock expired")
+
+// lockSuffix is appended to the key of a session for its lock.
+const lockSuffix = ":lock"
+
+// How often LockSession tries again to take a lock held by someone else.
+const lockRetryInterval = 10 * time.Millisecond
+
+// Script deleting KEYS[1] if its value is ARGV[1].
+const delIfValueScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+// unlockClient is implemented by clients able to release locks.
+type unlockClient interface {
+	// DelIfValue atomically deletes key if its value is value, and reports
+	// whether it did.
+	DelIfValue(ctx context.Context, key string, value []byte) (bool, error)
+}
+
+// SetLockWait sets how long LockSession waits for the lock of a session held
+// by someone else, or until its context is done, before returning
+// ErrSessionLocked. Zero, the default, fails fast.
+func (rs *RedisStore) SetLockWait(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.lockWait = d
+}
+
+// LockSession takes a lock over the session id, kept in redis next to the
+// session, for flows that must not run concurrently for the same session,
+// e.g. an OAuth callback racing a parallel AJAX request. The lock expires
+// after ttl, so a crashed holder never locks the session forever. Unlock
+// releases it, unless it already expired and returns ErrLockExpired. A lock
+// held by someone else makes LockSession return ErrSessionLocked, at once or
+// after the wait set by SetLockWait. Locks are advisory: loading and saving
+// the session doesn't check them. Read-only requests can't lock sessions.
+func (rs *RedisStore) LockSession(ctx context.Context, id string, ttl time.Duration) (unlock func() error, err error) {
+	rs.mu.RLock()
+	err = rs.open()
+	if err == nil {
+		err = rs.writable(ctx)
+	}
+	c, ok := rs.client().(setNXClient)
+	u, ok2 := rs.client().(unlockClient)
+	key, wait := rs.key(id)+lockSuffix, rs.lockWait
+	rs.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !ok2 {
+		return nil, errors.New("redisstore: client does not support session locks")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("redisstore: lock TTL must be positive")
+	}
+	token, err := randomID(minIDLength).Generate()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		set, err := c.SetNX(ctx, key, []byte(token), ttl)
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		if set {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			return nil, ErrSessionLocked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	unlockCtx := context.WithoutCancel(ctx)
+	return func() error {
+		deleted, err := u.DelIfValue(unlockCtx, key, []byte(token))
+		if err != nil {
+			return unavailable(err)
+		}
+		if !deleted {
+			return ErrLockExpired
+		}
+		return nil
+	}, nil
+}
+
+// WithSessionLock returns a gin middleware holding the lock of the session
+// name, see LockSession, for the rest of the request, with a TTL of ttl.
+// Requests for a locked session are aborted with 409 Conflict, and requests
+// failing to reach redis with 503 Service Unavailable. The lock is taken
+// before the session is loaded, from the ID of the cookie, so a request
+// waiting for it, see SetLockWait, sees what the holder saved. Requests
+// without a valid cookie, and read-only requests, aren't locked.
+func (rs *RedisStore) WithSessionLock(name string, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rs.mu.RLock()
+		id, readOnly := rs.requestID(c.Request, name), rs.readOnlyCtx(c.Request.Context())
+		rs.mu.RUnlock()
+		if id == "" || readOnly {
+			c.Next() // a new session, or the sessions middleware reports the error
+			return
+		}
+		unlock, err := rs.LockSession(c.Request.Context(), id, ttl)
+		switch {
+		case errors.Is(err, ErrSessionLocked):
+			c.AbortWithError(http.StatusConflict, err)
+			return
+		case errors.Is(err, ErrRedisUnavailable):
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+			return
+		case err != nil:
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				c.Error(err)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,141 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLockSession(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			ctx := context.Background()
+
+			unlock, err := store.LockSession(ctx, "id", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !mr.Exists("id" + lockSuffix) {
+				t.Error("expected the lock next to the session key")
+			}
+			start := time.Now()
+			if _, err := store.LockSession(ctx, "id", time.Minute); !errors.Is(err, ErrSessionLocked) {
+				t.Fatalf("expected ErrSessionLocked, got %v", err)
+			}
+			if time.Since(start) > 100*time.Millisecond {
+				t.Error("expected the second locker to fail fast")
+			}
+
+			store.SetLockWait(time.Second)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				unlock()
+			}()
+			start = time.Now()
+			unlock2, err := store.LockSession(ctx, "id", time.Minute)
+			if err != nil {
+				t.Fatalf("expected the second locker to wait for the lock, got %v", err)
+			}
+			if time.Since(start) < 50*time.Millisecond {
+				t.Error("expected the second locker to block while the lock is held")
+			}
+
+			// the holder crashed, the lock expires
+			mr.FastForward(time.Minute)
+			unlock3, err := store.LockSession(ctx, "id", time.Minute)
+			if err != nil {
+				t.Fatalf("expected the expired lock to be taken, got %v", err)
+			}
+			if err := unlock2(); !errors.Is(err, ErrLockExpired) {
+				t.Errorf("expected ErrLockExpired, got %v", err)
+			}
+			if err := unlock3(); err != nil {
+				t.Errorf("expected the lock of the new holder to be kept and released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWithSessionLock(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	r := gin.New()
+	r.Use(sessions.Sessions(sessionName, store), store.WithSessionLock(sessionName, time.Minute))
+	r.GET("/set", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/get", func(c *gin.Context) {
+		v, _ := sessions.Default(c).Get("key").(string)
+		c.String(http.StatusOK, v)
+	})
+
+	header := http.Header{"Cookie": {serve(r, "/set", nil).Header().Get("Set-Cookie")}}
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header = header
+	session, _ := store.New(req, sessionName)
+	unlock, err := store.LockSession(context.Background(), session.ID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := serve(r, "/get", header); res.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a locked session, got %d", res.Code)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if res := serve(r, "/get", header); res.Code != http.StatusOK || res.Body.String() != ok {
+		t.Errorf("expected the session once unlocked, got %d %q", res.Code, res.Body.String())
+	}
+	if _, err := store.LockSession(context.Background(), session.ID, time.Minute); err != nil {
+		t.Errorf("expected the middleware to release the lock, got %v", err)
+	}
+}
+
+func TestWithSessionLockWait(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetLockWait(time.Second)
+	r := gin.New()
+	r.Use(sessions.Sessions(sessionName, store), store.WithSessionLock(sessionName, time.Minute))
+	r.GET("/incr", func(c *gin.Context) {
+		session := sessions.Default(c)
+		n, _ := session.Get("count").(int)
+		time.Sleep(20 * time.Millisecond) // the other request waits for the lock
+		session.Set("count", n+1)
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/get", func(c *gin.Context) {
+		n, _ := sessions.Default(c).Get("count").(int)
+		c.String(http.StatusOK, "%d", n)
+	})
+
+	header := http.Header{"Cookie": {serve(r, "/incr", nil).Header().Get("Set-Cookie")}}
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- serve(r, "/incr", header).Code }()
+	}
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected the waiting request to get the lock, got %d", code)
+		}
+	}
+	if res := serve(r, "/get", header); res.Body.String() != "3" {
+		t.Errorf("expected the waiting request to see the saved count, got %q", res.Body.String())
+	}
+
+	store.Close()
+	if _, err := store.LockSession(context.Background(), "id", time.Minute); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package redisstore
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger receives the diagnostics of a store: events that are not errors of
+// the caller or that callers often ignore, like invalid cookies, corrupt or
+// oversized sessions, failed cleanups and codecs that can't be configured.
+// Args are alternating keys and values, e.g. "id", id. *slog.Logger
+// satisfies it, other loggers can be adapted with LoggerFunc.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...interface{})
+}
+
+// LoggerFunc adapts a function to a Logger.
+type LoggerFunc func(ctx context.Context, level slog.Level, msg string, args ...interface{})
+
+// Log calls f.
+func (f LoggerFunc) Log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	f(ctx, level, msg, args...)
+}
+
+// SetLogger sets the logger of the store. A nil logger, the default,
+// discards diagnostics.
+func (rs *RedisStore) SetLogger(l Logger) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.logger = l
+}
+
+// log sends a diagnostic to the logger of the store, if any.
+func (rs *RedisStore) log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	if rs.logger != nil {
+		rs.logger.Log(ctx, level, msg, args...)
+	}
+}
@@ -0,0 +1,97 @@
+package redisstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+)
+
+// capturingLogger records the logged entries as "LEVEL msg key=value...".
+type capturingLogger struct {
+	entries []string
+}
+
+func (l *capturingLogger) Log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	entry := level.String() + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		entry += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func TestSetLogger(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.Codecs = append(store.Codecs, plainCodec{})
+	// without a logger diagnostics are discarded
+	store.Options(sessions.Options{MaxAge: 100})
+
+	l := &capturingLogger{}
+	store.SetLogger(l)
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	store.Options(sessions.Options{MaxAge: 200})
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := io.ReadAll(r)
+	if len(printed) != 0 {
+		t.Errorf("expected nothing on stdout, got %q", printed)
+	}
+	if len(l.entries) != 1 || !strings.HasPrefix(l.entries[0], "WARN ") || !strings.Contains(l.entries[0], "plainCodec") {
+		t.Errorf("expected the unsupported codec to be logged, got %q", l.entries)
+	}
+	store.Codecs = store.Codecs[:1]
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", sessionName+"=invalid")
+	store.Get(req, sessionName)
+	if len(l.entries) != 2 || !strings.HasPrefix(l.entries[1], "DEBUG redisstore: invalid session cookie name="+sessionName) {
+		t.Errorf("expected the invalid cookie to be logged, got %q", l.entries)
+	}
+
+	store.SetMaxLength(10)
+	req2, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req2, sessionName)
+	session.Values["key"] = strings.Repeat("x", 100)
+	store.Save(req2, httptest.NewRecorder(), session)
+	if len(l.entries) != 3 || !strings.Contains(l.entries[2], "session too big id="+session.ID) {
+		t.Errorf("expected the oversized session to be logged, got %q", l.entries)
+	}
+}
+
+func TestLoggerCorruptSession(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	var buf bytes.Buffer
+	store.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(session.ID, "garbage")
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	store.Get(req2, sessionName)
+
+	entry := buf.String()
+	if !strings.Contains(entry, "level=WARN") || !strings.Contains(entry, "deleting corrupt session") ||
+		!strings.Contains(entry, "id="+session.ID) || !strings.Contains(entry, "error=") {
+		t.Errorf("expected the corrupt session in the slog output, got %q", entry)
+	}
+}
@@ -0,0 +1,128 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// lastAccessKey is the session value recording when a session was last
+// saved or refreshed, kept in redis along with createdKey when session metadata is
+// enabled. It is removed from the values returned by New.
+const lastAccessKey = "redisstore.last_access"
+
+// SetSessionMetadata makes the store record in every session when it was
+// created and last accessed, to the second, under reserved values hidden from
+// session.Values, see Metadata. Sessions are always stamped with their
+// creation time when an absolute max age is set. The last access moves on
+// every write, and on loads refreshing the TTL with RefreshOnGet or an idle
+// timeout; saving a session unchanged with SetResaveUnchanged(false) only
+// refreshes its TTL. Metadata is disabled by default.
+func (rs *RedisStore) SetSessionMetadata(on bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.metadata = on
+}
+
+// Metadata returns when session was created and last accessed, as recorded
+// in redis when it was loaded, or as of its last write. Both are zero for
+// sessions not saved yet, or saved without metadata.
+func (rs *RedisStore) Metadata(session *sessions.Session) (createdAt, lastAccess time.Time) {
+	st := rs.state(session)
+	if st == nil {
+		return time.Time{}, time.Time{}
+	}
+	return st.created, st.lastAccess
+}
+
+// Script setting KEYS[1] to ARGV[1] with a TTL of ARGV[3] milliseconds if
+// its value is still ARGV[2].
+const setIfEqualScript = `if redis.call("GET", KEYS[1]) ~= ARGV[2] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1`
+
+// equalClient is implemented by clients able to replace a value only if it
+// did not change.
+type equalClient interface {
+	// SetIfEqual atomically sets key to value, expiring after ttl if ttl is
+	// positive, if the value of key is old. It reports whether key was set.
+	SetIfEqual(ctx context.Context, key string, value []byte, ttl time.Duration, old []byte) (bool, error)
+}
+
+// access refreshes the TTL of session, loaded from raw, along with its last
+// access. Sessions written or deleted since they were loaded are left alone,
+// that write being newer. Without support for conditional writes, only the
+// TTL is refreshed.
+func (rs *RedisStore) access(ctx context.Context, session *sessions.Session, raw []byte) error {
+	key := rs.key(session.ID)
+	if rs.storage == HashMode {
+		h, err := rs.hashes()
+		if err != nil {
+			return err
+		}
+		now := rs.now().Unix()
+		b, err := rs.encodeField(session.ID, lastAccessKey, now)
+		if err != nil {
+			return err
+		}
+		found, err := h.HSetIfExists(ctx, key, lastAccessKey, b)
+		if err != nil || !found {
+			return unavailable(err)
+		}
+		if _, err := rs.client().Expire(ctx, key, rs.ttl(session)); err != nil {
+			return unavailable(err)
+		}
+		if st := rs.state(session); st != nil {
+			st.lastAccess = time.Unix(now, 0)
+		}
+		return nil
+	}
+	c, ok := rs.client().(equalClient)
+	if !ok {
+		_, err := rs.renew(ctx, session)
+		return unavailable(err)
+	}
+	defer rs.stamp(session)()
+	b, err := rs.serialize(session.ID, session)
+	if err != nil {
+		return err
+	}
+	if rs.versioned() {
+		// the values didn't change, neither does the version
+		b = append(append(make([]byte, 0, versionSize+len(b)), raw[:versionSize]...), b...)
+	}
+	set, err := c.SetIfEqual(ctx, key, b, rs.ttl(session), raw)
+	if err != nil || !set {
+		return unavailable(err)
+	}
+	rs.invalidate(ctx, key)
+	rs.written(session)
+	return nil
+}
+
+// written records the last access time stamped in the values of session once
+// they are written to redis.
+func (rs *RedisStore) written(session *sessions.Session) {
+	if st := rs.state(session); st != nil && rs.metadata {
+		st.lastAccess = unixTime(session.Values[lastAccessKey])
+	}
+}
+
+// unixTime returns the time of a session value holding Unix seconds, or the
+// zero time.
+func unixTime(v interface{}) time.Time {
+	switch v := v.(type) {
+	case int64:
+		return time.Unix(v, 0)
+	case float64: // JSON
+		return time.Unix(int64(v), 0)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,130 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetSessionMetadata(t *testing.T) {
+	for _, mode := range []StorageMode{BlobMode, HashMode} {
+		mr, client := newMiniRedis(t)
+		store := NewRedisStore(client, []byte("secret"))
+		store.SetStorageMode(mode)
+		store.SetSessionMetadata(true)
+		clock := newFakeClock(store, mr)
+		created := clock.Now()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.New(req, sessionName)
+		if c, a := store.Metadata(session); !c.IsZero() || !a.IsZero() {
+			t.Errorf("mode %d: expected no metadata before the first save, got %v %v", mode, c, a)
+		}
+		session.Values["key"] = ok
+		res := httptest.NewRecorder()
+		if err := store.Save(req, res, session); err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Values) != 1 {
+			t.Errorf("mode %d: expected the metadata not to be left in the values, got %v", mode, session.Values)
+		}
+
+		clock.Advance(time.Minute)
+		s, err := store.New(requestWith(res), sessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Values) != 1 || s.Values["key"] != ok {
+			t.Errorf("mode %d: expected the metadata to be hidden from the values, got %v", mode, s.Values)
+		}
+		if c, a := store.Metadata(s); !c.Equal(created) || !a.Equal(created) {
+			t.Errorf("mode %d: expected the times of the first save, got %v %v", mode, c, a)
+		}
+
+		s.Values["key"] = "changed"
+		if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+			t.Fatal(err)
+		}
+		s, _ = store.New(requestWith(res), sessionName)
+		if c, a := store.Metadata(s); !c.Equal(created) || !a.Equal(created.Add(time.Minute)) {
+			t.Errorf("mode %d: expected the last access to follow the save, got %v %v", mode, c, a)
+		}
+	}
+}
+
+func TestSessionMetadataUnchanged(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetSessionMetadata(true)
+	store.SetResaveUnchanged(false)
+	clock := newFakeClock(store, mr)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	for i := 0; i < 10; i++ {
+		session.Values[i] = i // maps with several keys aren't gob encoded in a stable order
+	}
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	s, _ := store.New(requestWith(res), sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	if counts["set"] != 1 {
+		t.Errorf("expected the last access not to make unchanged sessions dirty, got %d SETs", counts["set"])
+	}
+	if _, a := store.Metadata(s); !a.Equal(clock.Now().Add(-time.Minute)) {
+		t.Errorf("expected the last access of the last write, got %v", a)
+	}
+}
+
+func TestSessionMetadataRefreshOnGet(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			for _, versioned := range []bool{false, true} {
+				for _, mode := range []StorageMode{BlobMode, HashMode} {
+					store := NewRedisStoreWithClient(c, []byte("secret"))
+					store.SetStorageMode(mode)
+					store.SetVersionCheck(versioned)
+					store.SetSessionMetadata(true)
+					store.RefreshOnGet = true
+					clock := newFakeClock(store, mr)
+					created := clock.Now()
+
+					req, _ := http.NewRequest("GET", "/", nil)
+					session, _ := store.New(req, sessionName)
+					session.Values["key"] = ok
+					res := httptest.NewRecorder()
+					if err := store.Save(req, res, session); err != nil {
+						t.Fatal(err)
+					}
+
+					clock.Advance(time.Minute)
+					if _, err := store.New(requestWith(res), sessionName); err != nil {
+						t.Fatal(err)
+					}
+					s, err := store.New(requestWith(res), sessionName)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if s.Values["key"] != ok {
+						t.Errorf("mode %d, versioned %t: expected the values to be kept, got %v", mode, versioned, s.Values)
+					}
+					if c, a := store.Metadata(s); !c.Equal(created) || !a.Equal(created.Add(time.Minute)) {
+						t.Errorf("mode %d, versioned %t: expected the last access to follow the load, got %v %v", mode, versioned, c, a)
+					}
+					if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+						t.Errorf("mode %d, versioned %t: expected the refresh not to conflict with saves, got %v", mode, versioned, err)
+					}
+					mr.FlushAll()
+				}
+			}
+		})
+	}
+}
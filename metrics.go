@@ -0,0 +1,76 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metrics receives measurements of the redis operations of a store, e.g.
+// for Prometheus, see the prommetrics package. Methods are called
+// synchronously after each operation and should not block.
+type Metrics interface {
+	// ObserveLoad is called after a session of size bytes is looked up in
+	// redis; hit reports whether it was found.
+	ObserveLoad(d time.Duration, size int, hit bool)
+	// ObserveSave is called after a session of size bytes is written to
+	// redis. Size is zero if only the TTL of an unchanged session was
+	// refreshed.
+	ObserveSave(d time.Duration, size int)
+	// ObserveDelete is called after a session is deleted from redis.
+	ObserveDelete(d time.Duration)
+	// ObserveError is called instead when the operation op, "load", "save"
+	// or "delete", fails. It is also called with "fallback" each time a
+	// session is loaded from or saved to the fallback store.
+	ObserveError(op string)
+}
+
+// SetMetrics sets the metrics of the store. A nil Metrics, the default,
+// disables measurements.
+func (rs *RedisStore) SetMetrics(m Metrics) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.metrics = m
+}
+
+// operationKey is the context key of the operation being measured.
+type operationKey struct{}
+
+// operation measures a load, save or delete for the metrics of the store.
+type operation struct {
+	metrics Metrics
+	name    string
+	start   time.Time
+	size    int
+}
+
+// measure starts measuring the operation name, adding it to ctx for
+// spanSize. It returns a nil operation if the store has no metrics.
+func (rs *RedisStore) measure(ctx context.Context, name string) (context.Context, *operation) {
+	if rs.metrics == nil {
+		return ctx, nil
+	}
+	op := &operation{metrics: rs.metrics, name: name, start: time.Now()}
+	return context.WithValue(ctx, operationKey{}, op), op
+}
+
+// end reports op once done with err; hit is only used for loads. It does
+// nothing for a nil op.
+func (op *operation) end(hit bool, err error) {
+	if op == nil || errors.Is(err, errIDTaken) { // retried with another ID
+		return
+	}
+	if err != nil {
+		op.metrics.ObserveError(op.name)
+		return
+	}
+	d := time.Since(op.start)
+	switch op.name {
+	case "load":
+		op.metrics.ObserveLoad(d, op.size, hit)
+	case "save":
+		op.metrics.ObserveSave(d, op.size)
+	case "delete":
+		op.metrics.ObserveDelete(d)
+	}
+}
@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingMetrics records the operations it observes.
+type recordingMetrics struct {
+	events []string
+}
+
+func (m *recordingMetrics) ObserveLoad(d time.Duration, size int, hit bool) {
+	m.events = append(m.events, fmt.Sprintf("load %d %v", size, hit))
+}
+
+func (m *recordingMetrics) ObserveSave(d time.Duration, size int) {
+	m.events = append(m.events, fmt.Sprintf("save %d", size))
+}
+
+func (m *recordingMetrics) ObserveDelete(d time.Duration) {
+	m.events = append(m.events, "delete")
+}
+
+func (m *recordingMetrics) ObserveError(op string) {
+	m.events = append(m.events, "error "+op)
+}
+
+func TestSetMetrics(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	m := &recordingMetrics{}
+	store.SetMetrics(m)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := mr.Get(session.ID)
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	store.New(req2, sessionName)
+	store.Delete(session.ID)
+	store.New(req2, sessionName)
+	session.Options.MaxAge = -1
+	store.Save(req, httptest.NewRecorder(), session)
+	mr.Close()
+	session.Options.MaxAge = 0
+	if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Fatal("expected save to fail without redis")
+	}
+
+	expected := []string{
+		fmt.Sprintf("save %d", len(stored)),
+		fmt.Sprintf("load %d true", len(stored)),
+		"delete",
+		"load 0 false",
+		"delete",
+		"error save",
+	}
+	if !reflect.DeepEqual(m.events, expected) {
+		t.Errorf("expected events %q, got %q", expected, m.events)
+	}
+}
@@ -0,0 +1,69 @@
+package redisstore
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gorilla/sessions"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackSerializer uses MessagePack to encode the session map.
+// Only string keys are supported. Integers are decoded back as int64 (or
+// uint64 when they do not fit), binary values as []byte and nested maps as
+// map[string]interface{}.
+type MsgpackSerializer struct{}
+
+// Serialize to MessagePack. Will err if there are non-string keys
+func (s MsgpackSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	m, err := stringKeys(ss, "MessagePack")
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(m)
+}
+
+// Deserialize back to map[string]interface{}
+func (s MsgpackSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	m := make(map[string]interface{})
+	if err := msgpack.Unmarshal(d, &m); err != nil {
+		return fmt.Errorf("redisstore: cannot deserialize session from MessagePack: %w", err)
+	}
+	for k, v := range m {
+		ss.Values[k] = widenInts(v)
+	}
+	return nil
+}
+
+// widenInts converts the compact integer types msgpack decodes into int64,
+// so values read back do not depend on their magnitude. The loose decoding
+// mode of msgpack would do the same but also turns binary values into strings.
+func widenInts(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n)
+		}
+	case []interface{}:
+		for i := range n {
+			n[i] = widenInts(n[i])
+		}
+	case map[string]interface{}:
+		for k := range n {
+			n[k] = widenInts(n[k])
+		}
+	}
+	return v
+}
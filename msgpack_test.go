@@ -0,0 +1,80 @@
+package redisstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestMsgpackSerializer(t *testing.T) {
+	ss := sessions.NewSession(nil, sessionName)
+	ss.Values["key"] = ok
+	ss.Values["count"] = 3
+	ss.Values["binary"] = []byte{0, 1, 2, 0xff}
+	ss.Values["nested"] = map[string]interface{}{
+		"list": []interface{}{"a", 1.5},
+		"map":  map[string]interface{}{"deep": true},
+	}
+
+	b, err := MsgpackSerializer{}.Serialize(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := sessions.NewSession(nil, sessionName)
+	if err := (MsgpackSerializer{}).Deserialize(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Values["key"] != ok {
+		t.Errorf("expected %q, got %v", ok, decoded.Values["key"])
+	}
+	if decoded.Values["count"] != int64(3) {
+		t.Errorf("expected integers to come back as int64, got %#v", decoded.Values["count"])
+	}
+	if !bytes.Equal(decoded.Values["binary"].([]byte), []byte{0, 1, 2, 0xff}) {
+		t.Errorf("expected binary value to round-trip, got %#v", decoded.Values["binary"])
+	}
+	if !reflect.DeepEqual(decoded.Values["nested"], ss.Values["nested"]) {
+		t.Errorf("expected nested value to round-trip, got %#v", decoded.Values["nested"])
+	}
+
+	// depending on the value cut, the decoder reports io.EOF or io.ErrUnexpectedEOF
+	err = (MsgpackSerializer{}).Deserialize(b[:len(b)-1], decoded)
+	if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected truncated data to fail with an EOF error, got %v", err)
+	}
+
+	ss.Values[1] = "non-string key"
+	if _, err := (MsgpackSerializer{}).Serialize(ss); err == nil {
+		t.Error("expected error for non-string key")
+	}
+}
+
+func BenchmarkSerializerSize(b *testing.B) {
+	ss := sessions.NewSession(nil, sessionName)
+	ss.Values["user_id"] = "4b5e2c1a-9d3f-4c7e-8a6b-1f2e3d4c5b6a"
+	ss.Values["roles"] = []interface{}{"admin", "editor"}
+	ss.Values["login_count"] = 42
+	ss.Values["remember"] = true
+
+	for name, s := range map[string]SessionSerializer{
+		"gob":     GobSerializer{},
+		"json":    JSONSerializer{},
+		"msgpack": MsgpackSerializer{},
+	} {
+		b.Run(name, func(b *testing.B) {
+			var n int
+			for i := 0; i < b.N; i++ {
+				data, err := s.Serialize(ss)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n = len(data)
+			}
+			b.ReportMetric(float64(n), "bytes")
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keyspace notification events StartExpiryListener subscribes to.
+var expiryEvents = []string{"expired", "del"}
+
+// databaseClient is implemented by clients knowing the database they use.
+type databaseClient interface {
+	// Database returns the index of the database of the client, or a
+	// negative index if it doesn't know it.
+	Database() int
+}
+
+// expiryPattern returns the channel pattern of the keyspace notification
+// event in the database db, or in every database if db is negative.
+func expiryPattern(db int, event string) string {
+	if db < 0 {
+		return "__keyevent@*__:" + event
+	}
+	return fmt.Sprintf("__keyevent@%d__:%s", db, event)
+}
+
+// Backoff of StartExpiryListener between attempts to subscribe again.
+const (
+	minListenBackoff = 100 * time.Millisecond
+	maxListenBackoff = 30 * time.Second
+)
+
+// patternSubscriber is implemented by clients able to subscribe to channel
+// patterns.
+type patternSubscriber interface {
+	// PSubscribe calls fn with the channel and message of each message
+	// published to a channel matching pattern, from a single goroutine, until
+	// ctx is done or the subscription fails, and returns why.
+	PSubscribe(ctx context.Context, pattern string, fn func(channel string, message []byte)) error
+}
+
+// listeners tracks the expiry listeners of a store, stopped by Close.
+type listeners struct {
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+	running int // goroutines listening
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// done records the end of a listening goroutine.
+func (l *listeners) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+}
+
+// active reports whether listeners are running.
+func (l *listeners) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running > 0
+}
+
+// stop cancels the listeners and waits for them to return.
+func (l *listeners) stop() {
+	l.mu.Lock()
+	cancels := l.cancels
+	l.cancels, l.stopped = nil, true
+	l.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	l.wg.Wait()
+}
+
+// StartExpiryListener calls onExpire with the ID of each session expiring or
+// deleted in redis, e.g. to clean up related data or audit logouts, until ctx
+// is done or the store is closed. It relies on keyspace notifications, which
+// redis sends once notify-keyspace-events includes "Exg", e.g.
+//
+//	CONFIG SET notify-keyspace-events Exg
+//
+// Without them onExpire is never called. Only notifications of the database
+// of the store are received, or of every database with clients that don't
+// tell theirs, such as redigo pools. Only session keys under the prefix of
+// the store are reported, not the other keys kept next to them such as user
+// indexes, tag sets and locks, so stores with a KeyFunc can't listen, see
+// SetKeyFunc. Deletions of sessions rewritten at once, e.g. by a full
+// save in HashMode, aren't reported, but regenerated IDs are. The listener
+// subscribes again with backoff if the connection breaks, and misses the
+// notifications sent meanwhile. onExpire is called from a single goroutine
+// per notification type, and must not call Close or the setters of the
+// store.
+func (rs *RedisStore) StartExpiryListener(ctx context.Context, onExpire func(sessionID string)) error {
+	rs.mu.RLock()
+	p, ok := rs.client().(patternSubscriber)
+	c, prefix, db := rs.client(), rs.keyPrefix, -1
+	if d, ok := c.(databaseClient); ok {
+		db = d.Database()
+	}
+	keyFunc, err := rs.KeyFunc != nil, rs.open()
+	defer rs.mu.RUnlock() // until registered, see SetKeyFunc
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("redisstore: client does not support keyspace notifications")
+	}
+	if keyFunc {
+		return errors.New("redisstore: expiry listener requires keys under the key prefix")
+	}
+
+	rs.listeners.mu.Lock()
+	defer rs.listeners.mu.Unlock()
+	if rs.listeners.stopped {
+		return ErrStoreClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	rs.listeners.cancels = append(rs.listeners.cancels, cancel)
+	for _, event := range expiryEvents {
+		deleted := event == "del"
+		handle := func(_ string, message []byte) {
+			key := string(message)
+			if !strings.HasPrefix(key, prefix) || auxiliary(prefix, key) {
+				return
+			}
+			if deleted {
+				if exists, err := c.Exists(ctx, key); err != nil || exists {
+					return // rewritten, not gone
+				}
+			}
+			onExpire(strings.TrimPrefix(key, prefix))
+		}
+		rs.listeners.wg.Add(1)
+		rs.listeners.running++
+		go func(pattern string) {
+			defer rs.listeners.wg.Done()
+			defer rs.listeners.done()
+			rs.listen(ctx, p, pattern, handle)
+		}(expiryPattern(db, event))
+	}
+	return nil
+}
+
+// listen subscribes to pattern until ctx is done, subscribing again with
+// backoff when the subscription fails.
+func (rs *RedisStore) listen(ctx context.Context, p patternSubscriber, pattern string, fn func(channel string, message []byte)) {
+	backoff := minListenBackoff
+	for {
+		received := false
+		err := p.PSubscribe(ctx, pattern, func(channel string, message []byte) {
+			received = true
+			fn(channel, message)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = minListenBackoff
+		}
+		rs.mu.RLock()
+		rs.log(ctx, slog.LevelWarn, "redisstore: expiry listener disconnected", "pattern", pattern, "error", err, "retry", backoff)
+		rs.mu.RUnlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package redisstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// waitPatterns waits for n pattern subscriptions on mr.
+func waitPatterns(t *testing.T, mr *miniredis.Miniredis, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for mr.PubSubNumPat() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pattern subscriptions, got %d", n, mr.PubSubNumPat())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectExpired waits for the IDs reported by an expiry listener.
+func expectExpired(t *testing.T, expired <-chan string, ids ...string) {
+	t.Helper()
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	timeout := time.After(2 * time.Second)
+	for len(want) > 0 {
+		select {
+		case id := <-expired:
+			if !want[id] {
+				t.Fatalf("unexpected expired session %q", id)
+			}
+			delete(want, id)
+		case <-timeout:
+			t.Fatalf("expected expired sessions %v", want)
+		}
+	}
+}
+
+func TestStartExpiryListener(t *testing.T) {
+	// miniredis sends no keyspace notifications, they are published by hand
+	mr0, _ := newMiniRedis(t)
+	for name := range clients(t, mr0) {
+		t.Run(name, func(t *testing.T) {
+			mr, _ := newMiniRedis(t)
+			store := NewRedisStoreWithClient(clients(t, mr)[name], []byte("secret"))
+			store.SetKeyPrefix("s:")
+			expired := make(chan string, 10)
+			if err := store.StartExpiryListener(context.Background(), func(id string) { expired <- id }); err != nil {
+				t.Fatal(err)
+			}
+			waitPatterns(t, mr, 2)
+
+			mr.Set("s:rewritten", "data")
+			mr.Publish("__keyevent@0__:expired", "other:id")
+			mr.Publish("__keyevent@0__:expired", "s:user:u")
+			mr.Publish("__keyevent@0__:expired", "s:locked"+lockSuffix)
+			mr.Publish("__keyevent@0__:del", "s:rewritten")
+			mr.Publish("__keyevent@0__:expired", "s:expired")
+			mr.Publish("__keyevent@0__:del", "s:deleted")
+			expectExpired(t, expired, "expired", "deleted")
+
+			mr.Close()
+			if err := mr.Restart(); err != nil {
+				t.Fatal(err)
+			}
+			waitPatterns(t, mr, 2)
+			mr.Publish("__keyevent@0__:expired", "s:reconnected")
+			expectExpired(t, expired, "reconnected")
+
+			store.Close()
+			mr.Publish("__keyevent@0__:expired", "s:closed")
+			select {
+			case id := <-expired:
+				t.Errorf("expected no callback after Close, got %q", id)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if err := store.StartExpiryListener(context.Background(), func(string) {}); err != ErrStoreClosed {
+				t.Errorf("expected ErrStoreClosed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStartExpiryListenerDatabase(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	expired := map[int]chan string{}
+	for _, db := range []int{0, 1} {
+		store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithDB(db))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		expired[db] = make(chan string, 10)
+		if err := store.StartExpiryListener(context.Background(), func(id string) { expired[db] <- id }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitPatterns(t, mr, 4)
+
+	mr.Publish("__keyevent@1__:expired", "in1")
+	mr.Publish("__keyevent@0__:expired", "in0")
+	mr.Publish("__keyevent@2__:expired", "in2")
+	expectExpired(t, expired[0], "in0")
+	expectExpired(t, expired[1], "in1")
+	for db, ch := range expired {
+		select {
+		case id := <-ch:
+			t.Errorf("database %d: expected no notification of other databases, got %q", db, id)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestStartExpiryListenerContext(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := store.StartExpiryListener(ctx, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	waitPatterns(t, mr, 2)
+	keyFunc := func(id string) string { return "{s}" + id }
+	if err := store.SetKeyFunc(keyFunc); err == nil {
+		t.Error("expected SetKeyFunc to fail while listening")
+	}
+	cancel()
+	waitPatterns(t, mr, 0)
+	for deadline := time.Now().Add(time.Second); store.listeners.active() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if err := store.SetKeyFunc(keyFunc); err != nil {
+		t.Errorf("expected SetKeyFunc to succeed once stopped, got %v", err)
+	}
+	if err := store.StartExpiryListener(context.Background(), func(string) {}); err == nil {
+		t.Error("expected an error listening with a KeyFunc")
+	}
+
+	store = NewRedisStoreWithClient(&countingClient{Client: NewGoRedisV9Client(redis.NewClient(&redis.Options{Addr: mr.Addr()}))}, []byte("secret"))
+	if err := store.StartExpiryListener(context.Background(), func(string) {}); err == nil {
+		t.Error("expected an error for a client without pub/sub")
+	}
+}
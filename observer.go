@@ -0,0 +1,36 @@
+package redisstore
+
+// Observer is notified of the session operations of a store, for metrics or
+// audit logs. Methods are called synchronously after each successful
+// operation and should not block.
+type Observer interface {
+	// OnSave is called after session data of size bytes is written to redis.
+	OnSave(id string, size int)
+	// OnLoad is called after a session is looked up in redis; hit reports
+	// whether it was found.
+	OnLoad(id string, hit bool)
+	// OnDelete is called after a session is deleted from redis.
+	OnDelete(id string)
+}
+
+// SetObserver sets the observer notified of session operations. A nil
+// observer disables notifications.
+func (rs *RedisStore) SetObserver(o Observer) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.observer = o
+}
+
+// observe returns the observer of the store, which is never nil.
+func (rs *RedisStore) observe() Observer {
+	if rs.observer == nil {
+		return nopObserver{}
+	}
+	return rs.observer
+}
+
+type nopObserver struct{}
+
+func (nopObserver) OnSave(string, int)  {}
+func (nopObserver) OnLoad(string, bool) {}
+func (nopObserver) OnDelete(string)     {}
@@ -0,0 +1,66 @@
+package redisstore
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) OnSave(id string, size int) {
+	o.events = append(o.events, fmt.Sprintf("save %s %d", id, size))
+}
+
+func (o *recordingObserver) OnLoad(id string, hit bool) {
+	o.events = append(o.events, fmt.Sprintf("load %s %v", id, hit))
+}
+
+func (o *recordingObserver) OnDelete(id string) {
+	o.events = append(o.events, "delete "+id)
+}
+
+func TestSetObserver(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	o := &recordingObserver{}
+	store.SetObserver(o)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := mr.Get(session.ID)
+	id := session.ID
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	store.Get(req2, sessionName)
+	store.Delete(id)
+	store.New(req2, sessionName)
+
+	expected := []string{
+		fmt.Sprintf("save %s %d", id, len(stored)),
+		"load " + id + " true",
+		"delete " + id,
+		"load " + id + " false",
+	}
+	if !reflect.DeepEqual(o.events, expected) {
+		t.Errorf("expected events %q, got %q", expected, o.events)
+	}
+
+	store.SetObserver(nil)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.events) != len(expected) {
+		t.Error("expected no events after removing the observer")
+	}
+}
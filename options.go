@@ -0,0 +1,195 @@
+package redisstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// Option configures a RedisStore built by NewRedisStoreWithOptions.
+type Option func(rs *RedisStore) error
+
+// WithKeyPairs sets the key pairs used to sign and encrypt the session cookie.
+// At least one key pair is required. The signed values get the max age of
+// the store, whether WithMaxAge comes before or after.
+func WithKeyPairs(keyPairs ...[]byte) Option {
+	return func(rs *RedisStore) error {
+		rs.Codecs = securecookie.CodecsFromPairs(keyPairs...)
+		if age := rs.Options.MaxAge; age >= 0 {
+			for _, codec := range rs.Codecs {
+				if c, ok := codec.(*securecookie.SecureCookie); ok {
+					c.MaxAge(age)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// WithMaxAge sets the max age in seconds of sessions, 30 days by default,
+// see SetMaxAge.
+func WithMaxAge(age int) Option {
+	return func(rs *RedisStore) error {
+		return rs.SetMaxAge(age)
+	}
+}
+
+// WithIDEncoding sets the encoding of generated session IDs, see
+// SetIDEncoding.
+func WithIDEncoding(e IDEncoding) Option {
+	return func(rs *RedisStore) error {
+		return rs.SetIDEncoding(e)
+	}
+}
+
+// WithKeyPrefix sets the prefix prepended to session IDs to build redis keys.
+func WithKeyPrefix(p string) Option {
+	return func(rs *RedisStore) error {
+		rs.SetKeyPrefix(p)
+		return nil
+	}
+}
+
+// WithSerializer sets the serializer used to encode session values in redis.
+func WithSerializer(ss SessionSerializer) Option {
+	return func(rs *RedisStore) error {
+		if ss == nil {
+			return errors.New("redisstore: serializer must not be nil")
+		}
+		rs.SetSerializer(ss)
+		return nil
+	}
+}
+
+// WithMaxLength sets the maximum length of the serialized session, 4096
+// bytes by default. 0 disables the check, for sessions holding large values.
+func WithMaxLength(l int) Option {
+	return func(rs *RedisStore) error {
+		if l < 0 {
+			return errors.New("redisstore: max length must not be negative")
+		}
+		rs.SetMaxLength(l)
+		return nil
+	}
+}
+
+// WithDefaultMaxAge sets the redis TTL, in seconds, used for sessions
+// whose MaxAge is 0.
+func WithDefaultMaxAge(age int) Option {
+	return func(rs *RedisStore) error {
+		if age <= 0 {
+			return errors.New("redisstore: default max age must be positive")
+		}
+		rs.DefaultMaxAge = age
+		return nil
+	}
+}
+
+// WithCookieOptions sets the default options of the session cookie. Like
+// WithMaxAge, its MaxAge also bounds the age of the signed values, whether
+// WithKeyPairs comes before or after.
+func WithCookieOptions(opts *sessions.Options) Option {
+	return func(rs *RedisStore) error {
+		if opts == nil {
+			return errors.New("redisstore: cookie options must not be nil")
+		}
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		o := *opts
+		rs.Options = &o
+		if o.MaxAge < 0 {
+			return nil
+		}
+		return rs.setCodecsMaxAge(o.MaxAge)
+	}
+}
+
+// DefaultDatabases is the number of databases of a redis server unless its
+// databases setting says otherwise, see WithDatabases.
+const DefaultDatabases = 16
+
+// WithDB stores sessions in the redis database index to keep them apart
+// from the data of other applications sharing the server. The index must be
+// below the number of databases of the server, DefaultDatabases unless set
+// with WithDatabases. The store then uses a new client with the options of
+// the given one but the database, created once all options apply and
+// closed by Close; the given client is left as is. Only *redis.Client,
+// including failover clients, can select a database; redis cluster only
+// has database 0. The new client of a failover client shares its Dialer,
+// resolving the master through the sentinels of the given client, which
+// must stay open.
+func WithDB(index int) Option {
+	return func(rs *RedisStore) error {
+		if index < 0 {
+			return fmt.Errorf("redisstore: database must not be negative, got %d", index)
+		}
+		if _, ok := rs.RedisClient.(*redis.Client); !ok && index != 0 {
+			return fmt.Errorf("redisstore: can't select a database with a %T", rs.RedisClient)
+		}
+		rs.db = &index
+		return nil
+	}
+}
+
+// WithDatabases sets the number of databases of the redis server, its
+// databases setting, which the index of WithDB must be below.
+func WithDatabases(n int) Option {
+	return func(rs *RedisStore) error {
+		if n <= 0 {
+			return errors.New("redisstore: number of databases must be positive")
+		}
+		rs.databases = n
+		return nil
+	}
+}
+
+// selectDB switches the store to a client of the database set by WithDB.
+func (rs *RedisStore) selectDB() error {
+	if rs.db == nil {
+		return nil
+	}
+	if *rs.db >= rs.databases {
+		return fmt.Errorf("redisstore: database must be below %d, got %d", rs.databases, *rs.db)
+	}
+	c, ok := rs.RedisClient.(*redis.Client)
+	if !ok {
+		return nil // database 0 of a cluster
+	}
+	o := *c.Options()
+	if o.DB != *rs.db {
+		o.DB = *rs.db
+		rs.RedisClient = redis.NewClient(&o)
+		rs.ownsClient = true
+	}
+	return nil
+}
+
+// WithOwnedClient makes the store own the redis client it is given, closing
+// it on Close.
+func WithOwnedClient() Option {
+	return func(rs *RedisStore) error {
+		rs.ownsClient = true
+		return nil
+	}
+}
+
+// NewRedisStoreWithOptions returns a store configured by opts on top of the
+// defaults of NewRedisStore. WithKeyPairs is required.
+func NewRedisStoreWithOptions(redisClient redis.UniversalClient, opts ...Option) (*Store, error) {
+	rs := newDefaultRedisStore(redisClient)
+	for _, opt := range opts {
+		if err := opt(rs); err != nil {
+			return nil, err
+		}
+	}
+	if len(rs.Codecs) == 0 {
+		return nil, errors.New("redisstore: no key pairs given, use WithKeyPairs")
+	}
+	if err := rs.selectDB(); err != nil {
+		return nil, err
+	}
+	return &Store{rs}, nil
+}
@@ -0,0 +1,268 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWithKeyPrefix(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	storeA, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithKeyPrefix("a:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeB, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithKeyPrefix("b:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	sessionA, _ := storeA.New(req, sessionName)
+	sessionA.ID = "same-id"
+	sessionA.Values["key"] = "a"
+	if err := storeA.Save(req, httptest.NewRecorder(), sessionA); err != nil {
+		t.Fatal(err)
+	}
+	sessionB, _ := storeB.New(req, sessionName)
+	sessionB.ID = "same-id"
+	sessionB.Values["key"] = "b"
+	if err := storeB.Save(req, httptest.NewRecorder(), sessionB); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mr.Exists("a:same-id") || !mr.Exists("b:same-id") {
+		t.Error("expected both prefixed keys to exist")
+	}
+	if ok, err := storeA.load(context.Background(), sessionA); !ok || err != nil || sessionA.Values["key"] != "a" {
+		t.Errorf("expected store a to keep its own value, got %v (%v)", sessionA.Values["key"], err)
+	}
+}
+
+func TestNewRedisStoreWithOptions(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store, err := NewRedisStoreWithOptions(client,
+		WithKeyPairs([]byte("secret")),
+		WithSerializer(JSONSerializer{}),
+		WithMaxLength(0),
+		WithDefaultMaxAge(60),
+		WithCookieOptions(&sessions.Options{Path: "/app", MaxAge: 120, HttpOnly: true}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.serializer.(JSONSerializer); !ok {
+		t.Errorf("expected JSONSerializer, got %T", store.serializer)
+	}
+	if store.maxLength != 0 {
+		t.Errorf("expected max length 0, got %d", store.maxLength)
+	}
+	if store.DefaultMaxAge != 60 {
+		t.Errorf("expected default max age 60, got %d", store.DefaultMaxAge)
+	}
+	if store.RedisStore.Options.Path != "/app" || store.RedisStore.Options.MaxAge != 120 || !store.RedisStore.Options.HttpOnly {
+		t.Errorf("unexpected cookie options %+v", store.RedisStore.Options)
+	}
+}
+
+func TestNewRedisStoreWithOptionsErrors(t *testing.T) {
+	_, client := newMiniRedis(t)
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no key pairs", nil},
+		{"nil serializer", []Option{WithKeyPairs([]byte("secret")), WithSerializer(nil)}},
+		{"negative max length", []Option{WithKeyPairs([]byte("secret")), WithMaxLength(-1)}},
+		{"zero default max age", []Option{WithKeyPairs([]byte("secret")), WithDefaultMaxAge(0)}},
+		{"nil cookie options", []Option{WithKeyPairs([]byte("secret")), WithCookieOptions(nil)}},
+		{"negative database", []Option{WithKeyPairs([]byte("secret")), WithDB(-1)}},
+		{"database out of range", []Option{WithKeyPairs([]byte("secret")), WithDB(DefaultDatabases)}},
+		{"database beyond WithDatabases", []Option{WithKeyPairs([]byte("secret")), WithDB(8), WithDatabases(8)}},
+		{"no databases", []Option{WithKeyPairs([]byte("secret")), WithDatabases(0)}},
+		{"failing option after WithDB", []Option{WithKeyPairs([]byte("secret")), WithDB(2), WithMaxLength(-1)}},
+	}
+	for _, tt := range tests {
+		if store, err := NewRedisStoreWithOptions(client, tt.opts...); err == nil || store != nil {
+			t.Errorf("%s: expected error and no store, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestWithMaxLengthUnlimited(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithMaxLength(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = strings.Repeat("x", 64*1024)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatalf("expected a large session to be saved, got %v", err)
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	s, err := store.New(req2, sessionName)
+	if v, _ := s.Values["key"].(string); err != nil || len(v) != 64*1024 {
+		t.Errorf("expected the large session back, got %v", err)
+	}
+}
+
+func TestWithDB(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithDB(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	other := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.DB(2).Exists(session.ID) || mr.DB(0).Exists(session.ID) {
+		t.Error("expected the session in database 2 only")
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if s, err := other.New(req2, sessionName); err != nil || !s.IsNew {
+		t.Errorf("expected the session to be invisible from database 0, got %v", err)
+	}
+	if s, err := store.New(req2, sessionName); err != nil || s.IsNew || s.Values["key"] != ok {
+		t.Errorf("expected the session from database 2, got %v", err)
+	}
+}
+
+func TestWithDatabases(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithDB(DefaultDatabases), WithDatabases(32))
+	if err != nil {
+		t.Fatalf("expected a database below WithDatabases to be accepted, got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.DB(DefaultDatabases).Exists(session.ID) {
+		t.Errorf("expected the session in database %d", DefaultDatabases)
+	}
+}
+
+func TestWithDBCluster(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { client.Close() })
+	if _, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithDB(0)); err != nil {
+		t.Errorf("expected database 0 to be accepted, got %v", err)
+	}
+	if _, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithDB(1)); err == nil {
+		t.Error("expected error selecting a database on a cluster")
+	}
+}
+
+func TestWithMaxAge(t *testing.T) {
+	_, client := newMiniRedis(t)
+	short, err := NewRedisStoreWithOptions(client, WithMaxAge(60), WithKeyPairs([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithMaxAge(3600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := NewRedisStore(client, []byte("secret"))
+	if short.RedisStore.Options.MaxAge != 60 || long.RedisStore.Options.MaxAge != 3600 {
+		t.Errorf("expected max ages 60 and 3600, got %d and %d", short.RedisStore.Options.MaxAge, long.RedisStore.Options.MaxAge)
+	}
+	if defaults.RedisStore.Options.MaxAge != sessionExpire {
+		t.Errorf("expected other stores to keep the default max age, got %d", defaults.RedisStore.Options.MaxAge)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := short.New(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := short.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if cookie := res.Header().Get("Set-Cookie"); !strings.Contains(cookie, "Max-Age=60") {
+		t.Errorf("expected Max-Age=60 in %q", cookie)
+	}
+	if _, err := NewRedisStoreWithOptions(client, WithMaxAge(-1)); err == nil {
+		t.Error("expected error for a negative max age")
+	}
+}
+
+// codecMaxAge returns the max age of the values signed by c, a
+// *securecookie.SecureCookie.
+func codecMaxAge(c securecookie.Codec) int64 {
+	return reflect.ValueOf(c).Elem().FieldByName("maxAge").Int()
+}
+
+func TestWithCookieOptionsMaxAge(t *testing.T) {
+	_, client := newMiniRedis(t)
+	for name, opts := range map[string][]Option{
+		"after key pairs":  {WithKeyPairs([]byte("secret")), WithCookieOptions(&sessions.Options{Path: "/", MaxAge: 60})},
+		"before key pairs": {WithCookieOptions(&sessions.Options{Path: "/", MaxAge: 60}), WithKeyPairs([]byte("secret"))},
+	} {
+		store, err := NewRedisStoreWithOptions(client, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if age := codecMaxAge(store.Codecs[0]); age != 60 {
+			t.Errorf("%s: expected the codecs to get the cookie max age, got %d", name, age)
+		}
+	}
+}
+
+func TestNewRedisStoreWithOptionsDefaults(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := NewRedisStore(client, []byte("secret"))
+	if store.keyPrefix != defaults.keyPrefix {
+		t.Errorf("expected key prefix %q, got %q", defaults.keyPrefix, store.keyPrefix)
+	}
+	if _, ok := store.serializer.(GobSerializer); !ok {
+		t.Errorf("expected GobSerializer, got %T", store.serializer)
+	}
+	if store.maxLength != defaults.maxLength {
+		t.Errorf("expected max length %d, got %d", defaults.maxLength, store.maxLength)
+	}
+	if store.DefaultMaxAge != defaults.DefaultMaxAge {
+		t.Errorf("expected default max age %d, got %d", defaults.DefaultMaxAge, store.DefaultMaxAge)
+	}
+	if *store.RedisStore.Options != *defaults.RedisStore.Options {
+		t.Errorf("expected cookie options %+v, got %+v", defaults.RedisStore.Options, store.RedisStore.Options)
+	}
+}
+
+func TestNewRedisStoreWithoutKeyPairs(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client)
+	if store == nil || len(store.Codecs) != 0 {
+		t.Fatalf("expected a store without codecs, got %v", store)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Error("expected saving without key pairs to fail")
+	}
+}
@@ -0,0 +1,79 @@
+// Package prommetrics reports the redis operations of a redisstore to
+// Prometheus.
+//
+//	m := prommetrics.New(prometheus.DefaultRegisterer)
+//	store.SetMetrics(m)
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements redisstore.Metrics with Prometheus collectors, all in
+// the redisstore namespace.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	loads    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+}
+
+// New returns Metrics with collectors registered with reg. It panics if they
+// are already registered, like prometheus.MustRegister.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "redisstore",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the successful session operations, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}, []string{"op"}),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "redisstore",
+			Name:      "session_size_bytes",
+			Help:      "Size of the sessions loaded or saved, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(64, 2, 10),
+		}, []string{"op"}),
+		loads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "redisstore",
+			Name:      "loads_total",
+			Help:      "Sessions looked up in redis, by result: hit or miss.",
+		}, []string{"result"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "redisstore",
+			Name:      "errors_total",
+			Help:      "Failed session operations, by operation.",
+		}, []string{"op"}),
+	}
+	reg.MustRegister(m.duration, m.size, m.loads, m.errors)
+	return m
+}
+
+// ObserveLoad implements redisstore.Metrics.
+func (m *Metrics) ObserveLoad(d time.Duration, size int, hit bool) {
+	m.duration.WithLabelValues("load").Observe(d.Seconds())
+	if !hit {
+		m.loads.WithLabelValues("miss").Inc()
+		return
+	}
+	m.loads.WithLabelValues("hit").Inc()
+	m.size.WithLabelValues("load").Observe(float64(size))
+}
+
+// ObserveSave implements redisstore.Metrics.
+func (m *Metrics) ObserveSave(d time.Duration, size int) {
+	m.duration.WithLabelValues("save").Observe(d.Seconds())
+	m.size.WithLabelValues("save").Observe(float64(size))
+}
+
+// ObserveDelete implements redisstore.Metrics.
+func (m *Metrics) ObserveDelete(d time.Duration) {
+	m.duration.WithLabelValues("delete").Observe(d.Seconds())
+}
+
+// ObserveError implements redisstore.Metrics.
+func (m *Metrics) ObserveError(op string) {
+	m.errors.WithLabelValues(op).Inc()
+}
@@ -0,0 +1,42 @@
+package prommetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zcxzcxczcx/redisstore"
+)
+
+var _ redisstore.Metrics = &Metrics{}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+	m.ObserveLoad(time.Millisecond, 100, true)
+	m.ObserveLoad(time.Millisecond, 0, false)
+	m.ObserveSave(time.Millisecond, 100)
+	m.ObserveDelete(time.Millisecond)
+	m.ObserveError("save")
+
+	expected := `
+# HELP redisstore_loads_total Sessions looked up in redis, by result: hit or miss.
+# TYPE redisstore_loads_total counter
+redisstore_loads_total{result="hit"} 1
+redisstore_loads_total{result="miss"} 1
+# HELP redisstore_errors_total Failed session operations, by operation.
+# TYPE redisstore_errors_total counter
+redisstore_errors_total{op="save"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "redisstore_loads_total", "redisstore_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.duration); n != 3 {
+		t.Errorf("expected durations of 3 operations, got %d", n)
+	}
+	if n := testutil.CollectAndCount(m.size); n != 2 {
+		t.Errorf("expected sizes of loads and saves, got %d", n)
+	}
+}
@@ -0,0 +1,51 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrReadOnly is returned by the methods writing to redis other than Save,
+// such as Delete or RegenerateID, when sessions are read-only, see
+// SetReadOnly and ReadOnlyContext.
+var ErrReadOnly = errors.New("redisstore: sessions are read-only")
+
+// readOnlyKey is the context key marking requests as read-only.
+type readOnlyKey struct{}
+
+// SetReadOnly makes the store read-only, see ReadOnlyContext, e.g. for a
+// replica serving read-heavy pages. SaveToken and SaveByID then write
+// nothing either, like Save, the other methods writing to redis return
+// ErrReadOnly, and HealthCheck skips its probe.
+func (rs *RedisStore) SetReadOnly(on bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.readOnly = on
+}
+
+// ReadOnlyContext returns a copy of ctx loading and saving sessions
+// read-only, e.g. for the request of an endpoint only reading session data:
+//
+//	r = r.WithContext(redisstore.ReadOnlyContext(r.Context()))
+//
+// Loads don't refresh the TTL of sessions, even with RefreshOnGet or an idle
+// timeout, nor delete sessions past their absolute max age, older than
+// MinSchemaVersion or corrupt, which only come back empty. Save writes
+// nothing to redis, deletions included, but still sets the cookie of loaded
+// sessions as usual. Changes to the values of a session are lost.
+func ReadOnlyContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// readOnlyCtx reports whether sessions are read-only for ctx.
+func (rs *RedisStore) readOnlyCtx(ctx context.Context) bool {
+	return rs.readOnly || ctx.Value(readOnlyKey{}) != nil
+}
+
+// writable returns ErrReadOnly if sessions are read-only for ctx.
+func (rs *RedisStore) writable(ctx context.Context) error {
+	if rs.readOnlyCtx(ctx) {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestReadOnlyContext(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	store.RefreshOnGet = true
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	ttl := mr.TTL(session.ID)
+	mr.FastForward(time.Minute)
+	for k := range counts {
+		delete(counts, k)
+	}
+
+	req2 := requestWith(res)
+	req2 = req2.WithContext(ReadOnlyContext(req2.Context()))
+	s, err := store.New(req2, sessionName)
+	if err != nil || s.Values["key"] != ok {
+		t.Fatalf("expected the session to load, got %v", err)
+	}
+	s.Values["key"] = "changed"
+	res2 := httptest.NewRecorder()
+	if err := store.Save(req2, res2, s); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts["get"] != 1 {
+		t.Errorf("expected a single GET and no writes, got %v", counts)
+	}
+	if res2.Header().Get("Set-Cookie") == "" {
+		t.Error("expected the cookie to be refreshed")
+	}
+	if mr.TTL(session.ID) != ttl-time.Minute {
+		t.Error("expected the TTL not to be refreshed")
+	}
+	if s, _ := store.New(requestWith(res), sessionName); s.Values["key"] != ok {
+		t.Errorf("expected the stored session to be unchanged, got %v", s.Values["key"])
+	}
+
+	s.Options.MaxAge = -1
+	if err := store.Save(req2, httptest.NewRecorder(), s); err != nil || !mr.Exists(session.ID) {
+		t.Errorf("expected a read-only save not to delete the session, got %v", err)
+	}
+
+	store.SetReadOnly(true)
+	session, _ = store.New(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil || session.ID != "" {
+		t.Errorf("expected a read-only store not to create sessions, got %v", err)
+	}
+}
+
+func TestReadOnlyContextKeepsInvalidSessions(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	clock := newFakeClock(store, mr)
+	store.SetAbsoluteMaxAge(time.Hour)
+	store.SchemaVersion = 1
+
+	for name, invalidate := range map[string]func(id string){
+		"expired": func(string) { clock.now = clock.now.Add(2 * time.Hour) }, // the TTL would drop the key
+		"corrupt": func(id string) { mr.Set(id, "garbage") },
+		"outdated": func(string) {
+			store.SchemaVersion, store.MinSchemaVersion = 3, 2
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store.SchemaVersion, store.MinSchemaVersion = 1, 0
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.New(req, sessionName)
+			session.Values["key"] = ok
+			res := httptest.NewRecorder()
+			if err := store.Save(req, res, session); err != nil {
+				t.Fatal(err)
+			}
+			invalidate(session.ID)
+			for k := range counts {
+				delete(counts, k)
+			}
+
+			req2 := requestWith(res)
+			req2 = req2.WithContext(ReadOnlyContext(req2.Context()))
+			s, err := store.New(req2, sessionName)
+			if err != nil || len(s.Values) != 0 {
+				t.Fatalf("expected the session to come back empty, got %v, %v", s.Values, err)
+			}
+			if counts["del"] != 0 || !mr.Exists(session.ID) {
+				t.Errorf("expected a read-only load not to delete the session, got %v", counts)
+			}
+		})
+	}
+}
+
+func TestReadOnlyStoreWrites(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	store.SetReadOnly(true)
+	for k := range counts {
+		delete(counts, k)
+	}
+
+	loaded, err := store.LoadByID(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Values["key"] = "changed"
+	if token, err := store.SaveToken(loaded); err != nil || token == "" {
+		t.Errorf("expected SaveToken to return the token of a loaded session, got %q, %v", token, err)
+	}
+	if err := store.SaveByID(loaded); err != nil {
+		t.Errorf("expected SaveByID to do nothing, got %v", err)
+	}
+	fresh, _ := store.New(req, sessionName)
+	if token, err := store.SaveToken(fresh); err != nil || token != "" || fresh.ID != "" {
+		t.Errorf("expected SaveToken not to create sessions, got %q, %v", token, err)
+	}
+	if err := store.RegenerateID(req, httptest.NewRecorder(), loaded); !errors.Is(err, ErrReadOnly) || loaded.ID != session.ID {
+		t.Errorf("expected RegenerateID to fail with ErrReadOnly, got %v", err)
+	}
+
+	ctx := context.Background()
+	for name, write := range map[string]func() error{
+		"Delete":           func() error { _, err := store.Delete(session.ID); return err },
+		"Touch":            func() error { return store.Touch(loaded) },
+		"SetField":         func() error { return store.SetField(ctx, session.ID, "key", "changed") },
+		"Flush":            func() error { return store.Flush(ctx) },
+		"DeleteAll":        func() error { _, err := store.DeleteAll(ctx); return err },
+		"DeleteExpired":    func() error { _, err := store.DeleteExpired(ctx, time.Hour); return err },
+		"InvalidateTag":    func() error { return store.InvalidateTag(ctx, "tag") },
+		"DeleteAllForUser": func() error { return store.DeleteAllForUser("alice") },
+		"LockSession":      func() error { _, err := store.LockSession(ctx, session.ID, time.Second); return err },
+		"DeleteWhere": func() error {
+			_, err := store.DeleteWhere(ctx, func(string, *sessions.Session) bool { return true })
+			return err
+		},
+	} {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	if len(counts) != 1 || counts["get"] != 1 {
+		t.Errorf("expected a single GET and no writes, got %v", counts)
+	}
+	if s, err := store.LoadByID(session.ID); err != nil || s.Values["key"] != ok {
+		t.Errorf("expected the stored session to be unchanged, got %v, %v", s, err)
+	}
+	if !mr.Exists(session.ID) {
+		t.Error("expected the session to be kept")
+	}
+}
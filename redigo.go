@@ -0,0 +1,494 @@
+package redisstore
+
+import (
+	"context"
+	"io"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// NewRedigoClient returns a Client running commands with connections from
+// a github.com/gomodule/redigo pool.
+func NewRedigoClient(pool *redigo.Pool) Client {
+	return redigoClient{pool}
+}
+
+// redigoClient runs commands with a redigo pool.
+type redigoClient struct {
+	pool *redigo.Pool
+}
+
+func (c redigoClient) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redigo.DoContext(conn, ctx, cmd, args...)
+}
+
+func (c redigoClient) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := redigo.Bytes(c.do(ctx, "GET", key))
+	if err == redigo.ErrNil {
+		return nil, ErrNil
+	}
+	return b, err
+}
+
+func (c redigoClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", setArgs(key, value, ttl)...)
+	return err
+}
+
+func (c redigoClient) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := c.do(ctx, "SET", append(setArgs(key, value, ttl), "NX")...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// setArgs returns the arguments of a SET expiring after ttl.
+func setArgs(key string, value []byte, ttl time.Duration) []interface{} {
+	args := []interface{}{key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	return args
+}
+
+func (c redigoClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	return redigo.Int64(c.do(ctx, "DEL", redigo.Args{}.AddFlat(keys)...))
+}
+
+func (c redigoClient) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return redigo.Bool(c.do(ctx, "PEXPIRE", key, ttl.Milliseconds()))
+}
+
+func (c redigoClient) Exists(ctx context.Context, key string) (bool, error) {
+	return redigo.Bool(c.do(ctx, "EXISTS", key))
+}
+
+func (c redigoClient) SetDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	set := append(redigo.Args{"SET"}, setArgs(key, value, ttl)...)
+	return multi(ctx, conn, set, redigo.Args{"DEL", oldKey})
+}
+
+var setNXDelRedigo = redigo.NewScript(2, setNXDelScript)
+
+func (c redigoClient) SetNXDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redigo.Bool(setNXDelRedigo.DoContext(ctx, conn, key, oldKey, value, ttl.Milliseconds()))
+}
+
+func (c redigoClient) HSet(ctx context.Context, key string, fields map[string][]byte, ttl time.Duration) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	cmds := []redigo.Args{{"DEL", key}, redigo.Args{"HSET", key}.AddFlat(fields)}
+	if ttl > 0 {
+		cmds = append(cmds, redigo.Args{"PEXPIRE", key, ttl.Milliseconds()})
+	}
+	return multi(ctx, conn, cmds...)
+}
+
+// multi runs cmds, each a command name followed by its arguments, in a
+// transaction on conn. It returns the first error of the transaction or of
+// one of its commands, which redis reports in the reply of EXEC.
+func multi(ctx context.Context, conn redigo.Conn, cmds ...redigo.Args) error {
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			return err
+		}
+	}
+	replies, err := redigo.Values(redigo.DoContext(conn, ctx, "EXEC"))
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redigo.Error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c redigoClient) HGetAll(ctx context.Context, key string) (map[string][]byte, error) {
+	values, err := redigo.ByteSlices(c.do(ctx, "HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string][]byte, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields[string(values[i])] = values[i+1]
+	}
+	return fields, nil
+}
+
+func (c redigoClient) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	b, err := redigo.Bytes(c.do(ctx, "HGET", key, field))
+	if err == redigo.ErrNil {
+		return nil, ErrNil
+	}
+	return b, err
+}
+
+var hsetIfExistsRedigo = redigo.NewScript(1, hsetIfExistsScript)
+
+func (c redigoClient) HSetIfExists(ctx context.Context, key, field string, value []byte) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redigo.Bool(hsetIfExistsRedigo.DoContext(ctx, conn, key, field, value))
+}
+
+var delIfValueRedigo = redigo.NewScript(1, delIfValueScript)
+
+func (c redigoClient) DelIfValue(ctx context.Context, key string, value []byte) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redigo.Bool(delIfValueRedigo.DoContext(ctx, conn, key, value))
+}
+
+var zaddNXRedigo = redigo.NewScript(1, zaddNXScript)
+
+func (c redigoClient) ZAddNX(ctx context.Context, key, member string, score int64, ttl time.Duration) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = zaddNXRedigo.DoContext(ctx, conn, key, member, score, ttl.Milliseconds())
+	return err
+}
+
+func (c redigoClient) ZRem(ctx context.Context, key string, members ...string) error {
+	_, err := c.do(ctx, "ZREM", redigo.Args{key}.AddFlat(members)...)
+	return err
+}
+
+func (c redigoClient) ZRange(ctx context.Context, key string) ([]string, error) {
+	return redigo.Strings(c.do(ctx, "ZRANGE", key, 0, -1))
+}
+
+var saddRedigo = redigo.NewScript(1, saddScript)
+
+func (c redigoClient) SAdd(ctx context.Context, key, member string, ttl time.Duration) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = saddRedigo.DoContext(ctx, conn, key, member, ttl.Milliseconds())
+	return err
+}
+
+func (c redigoClient) SRem(ctx context.Context, key string, members ...string) error {
+	_, err := c.do(ctx, "SREM", redigo.Args{key}.AddFlat(members)...)
+	return err
+}
+
+func (c redigoClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	return redigo.Strings(c.do(ctx, "SMEMBERS", key))
+}
+
+func (c redigoClient) Scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	cursor := uint64(0)
+	for {
+		keys, next, err := c.ScanPage(ctx, cursor, match, scanCount)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (c redigoClient) ScanPage(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error) {
+	values, err := redigo.Values(c.do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", count))
+	if err != nil {
+		return nil, 0, err
+	}
+	var keys []string
+	if _, err := redigo.Scan(values, &cursor, &keys); err != nil {
+		return nil, 0, err
+	}
+	return keys, cursor, nil
+}
+
+func (c redigoClient) DelPipelined(ctx context.Context, keys ...string) (int64, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	for _, key := range keys {
+		if err := conn.Send("DEL", key); err != nil {
+			return 0, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return 0, err
+	}
+	var n int64
+	for range keys {
+		deleted, err := redigo.Int64(redigo.ReceiveContext(conn, ctx))
+		if err != nil {
+			return n, err
+		}
+		n += deleted
+	}
+	return n, nil
+}
+
+func (c redigoClient) GetPipelined(ctx context.Context, keys ...string) ([][]byte, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for _, key := range keys {
+		if err := conn.Send("GET", key); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i := range keys {
+		b, err := redigo.Bytes(redigo.ReceiveContext(conn, ctx))
+		if err == redigo.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = b
+	}
+	return values, nil
+}
+
+func (c redigoClient) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if err := conn.Send("GET", key); err != nil {
+		return nil, 0, err
+	}
+	if err := conn.Send("PTTL", key); err != nil {
+		return nil, 0, err
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, 0, err
+	}
+	b, err := redigo.Bytes(redigo.ReceiveContext(conn, ctx))
+	if err != nil && err != redigo.ErrNil {
+		return nil, 0, err
+	}
+	ms, perr := redigo.Int64(redigo.ReceiveContext(conn, ctx))
+	if err == redigo.ErrNil {
+		return nil, 0, ErrNil
+	}
+	if perr != nil {
+		return nil, 0, perr
+	}
+	if ms < 0 {
+		return b, -1, nil
+	}
+	return b, time.Duration(ms) * time.Millisecond, nil
+}
+
+func (c redigoClient) Publish(ctx context.Context, channel string, message []byte) error {
+	_, err := c.do(ctx, "PUBLISH", channel, message)
+	return err
+}
+
+func (c redigoClient) Subscribe(ctx context.Context, channel string, fn func(message []byte)) (io.Closer, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	psc := redigo.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the first reply confirms the subscription
+	if err, ok := psc.ReceiveContext(ctx).(error); ok {
+		conn.Close()
+		return nil, err
+	}
+	sub := &redigoSubscription{psc: psc, done: make(chan struct{})}
+	go func() {
+		defer close(sub.done)
+		for {
+			switch v := psc.Receive().(type) {
+			case redigo.Message:
+				fn(v.Data)
+			case redigo.Subscription:
+				if v.Count == 0 {
+					return
+				}
+			case error:
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func (c redigoClient) PSubscribe(ctx context.Context, pattern string, fn func(channel string, message []byte)) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	psc := redigo.PubSubConn{Conn: conn}
+	if err := psc.PSubscribe(pattern); err != nil {
+		conn.Close()
+		return err
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			psc.PUnsubscribe() // ends the receiving loop
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done // no more writes, the connection can be released
+		conn.Close()
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case redigo.Message:
+			fn(v.Channel, v.Data)
+		case redigo.Subscription:
+			if v.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// redigoSubscription is a subscription of a redigo connection.
+type redigoSubscription struct {
+	psc  redigo.PubSubConn
+	done chan struct{} // closed once the receiving goroutine returns
+}
+
+// Close unsubscribes, waits for the receiving goroutine to return and
+// releases the connection. A connection failing to unsubscribe fails to
+// receive too, so the goroutine returns either way.
+func (s *redigoSubscription) Close() error {
+	err := s.psc.Unsubscribe()
+	<-s.done
+	if cerr := s.psc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c redigoClient) TTLPipelined(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for _, key := range keys {
+		if err := conn.Send("PTTL", key); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	ttls := make([]time.Duration, len(keys))
+	for i := range keys {
+		ms, err := redigo.Int64(redigo.ReceiveContext(conn, ctx))
+		if err != nil {
+			return nil, err
+		}
+		ttls[i] = -1
+		if ms >= 0 {
+			ttls[i] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return ttls, nil
+}
+
+func (c redigoClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := redigo.Int64(c.do(ctx, "PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+var setIfVersionRedigo = redigo.NewScript(1, setIfVersionScript)
+
+func (c redigoClient) SetIfVersion(ctx context.Context, key string, value []byte, ttl time.Duration, version []byte) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redigo.Bool(setIfVersionRedigo.DoContext(ctx, conn, key, value, version, ttl.Milliseconds()))
+}
+
+var setIfEqualRedigo = redigo.NewScript(1, setIfEqualScript)
+
+func (c redigoClient) SetIfEqual(ctx context.Context, key string, value []byte, ttl time.Duration, old []byte) (bool, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return redigo.Bool(setIfEqualRedigo.DoContext(ctx, conn, key, value, old, ttl.Milliseconds()))
+}
+
+func (c redigoClient) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+func (c redigoClient) Close() error {
+	return c.pool.Close()
+}
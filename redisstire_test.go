@@ -1,34 +1,59 @@
 package redisstore
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
+	redisv6 "github.com/go-redis/redis"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/goleak"
+)
+
+var (
+	_ sessions.Store  = &Store{}
+	_ gsessions.Store = &Store{}
 )
 
 const sessionName = "mysession"
 const ok = "ok"
 
-var newRedisStore = func(_ *testing.T) store {
-
+// newRedisStore returns a store for t and a function moving the time of
+// redis forward. The store is backed by miniredis, or by the redis cluster
+// whose comma separated ip:port list is in REDIS_ADDRS, with the password in
+// REDIS_PASSWORD. On a real cluster, keys are prefixed with the test name and
+// moving time forward sleeps.
+func newRedisStore(t *testing.T) (*Store, func(time.Duration)) {
+	addrs := os.Getenv("REDIS_ADDRS")
+	if addrs == "" {
+		mr, client := newMiniRedis(t)
+		return NewRedisStore(client, []byte("secret")), mr.FastForward
+	}
 	client := redis.NewClusterClient(&redis.ClusterOptions{
-		Addrs:    []string{}, //cluster ip:port list
-		Password: "",         //set password
+		Addrs:    strings.Split(addrs, ","),
+		Password: os.Getenv("REDIS_PASSWORD"),
 	})
-
-	pong, err := client.Ping().Result()
-	if err != nil {
-		panic(err)
+	t.Cleanup(func() { client.Close() })
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatal(err)
 	}
-	fmt.Println(pong)
 	store := NewRedisStore(client, []byte("secret"))
-	return store
+	store.SetKeyPrefix(fmt.Sprintf("redisstore-test:%s:%d:", t.Name(), time.Now().UnixNano()))
+	return store, time.Sleep
 }
 
 func init() {
@@ -36,12 +61,13 @@ func init() {
 }
 
 func TestSessionGetSet(t *testing.T) {
-	GetSet(t, newRedisStore(t))
+	store, _ := newRedisStore(t)
+	GetSet(t, store)
 }
 
 func GetSet(t *testing.T, newStore sessions.Store) {
 	r := gin.Default()
-	r.Use(sessions.Sessions(sessionName, newRedisStore(t)))
+	r.Use(sessions.Sessions(sessionName, newStore))
 
 	r.GET("/set", func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -68,7 +94,7 @@ func GetSet(t *testing.T, newStore sessions.Store) {
 }
 func TestSessionExpire(t *testing.T) {
 	expireTime := 10
-	store := newRedisStore(t)
+	store, fastForward := newRedisStore(t)
 	store.SetMaxAge(expireTime)
 	r := gin.Default()
 	r.Use(sessions.Sessions(sessionName, store))
@@ -101,10 +127,1090 @@ func TestSessionExpire(t *testing.T) {
 	req2, _ := http.NewRequest("GET", "/get", nil)
 	req2.Header.Set("Cookie", res1.Header().Get("Set-Cookie"))
 	r.ServeHTTP(res2, req2)
-	time.Sleep(time.Duration(expireTime) * time.Second)
+	fastForward(time.Duration(expireTime) * time.Second)
 	res3 := httptest.NewRecorder()
 	req3, _ := http.NewRequest("GET", "/get2", nil)
+	req3.Header.Set("Cookie", res1.Header().Get("Set-Cookie"))
+	r.ServeHTTP(res3, req3)
+
+}
+
+func TestSessionDelete(t *testing.T) {
+	store, _ := newRedisStore(t)
+	r := gin.Default()
+	r.Use(sessions.Sessions(sessionName, store))
+
+	r.GET("/set", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/delete", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Options(sessions.Options{MaxAge: -1})
+		if err := session.Save(); err != nil {
+			t.Error(err)
+		}
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/get", func(c *gin.Context) {
+		session := sessions.Default(c)
+		if session.Get("key") != nil {
+			t.Error("Session should be deleted")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	res1 := httptest.NewRecorder()
+	req1, _ := http.NewRequest("GET", "/set", nil)
+	r.ServeHTTP(res1, req1)
+	res2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest("GET", "/delete", nil)
 	req2.Header.Set("Cookie", res1.Header().Get("Set-Cookie"))
+	r.ServeHTTP(res2, req2)
+	res3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest("GET", "/get", nil)
+	req3.Header.Set("Cookie", res1.Header().Get("Set-Cookie"))
 	r.ServeHTTP(res3, req3)
+}
+
+func TestSessionMaxLength(t *testing.T) {
+	store, _ := newRedisStore(t)
+	store.SetMaxLength(1024)
+	r := gin.Default()
+	r.Use(sessions.Sessions(sessionName, store))
+
+	r.GET("/set", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("key", strings.Repeat("x", 2048))
+		if err := session.Save(); err == nil {
+			t.Error("Session over the max length should not be saved")
+		}
+		session.Set("key", ok)
+		if err := session.Save(); err != nil {
+			t.Error(err)
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/set", nil)
+	r.ServeHTTP(res, req)
+}
+
+func TestJSONSerializer(t *testing.T) {
+	ss := gsessions.NewSession(nil, sessionName)
+	ss.Values["key"] = ok
+	ss.Values["count"] = 3
+
+	b, err := JSONSerializer{}.Serialize(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := gsessions.NewSession(nil, sessionName)
+	if err := (JSONSerializer{}).Deserialize(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Values["key"] != ok {
+		t.Errorf("expected %q, got %v", ok, decoded.Values["key"])
+	}
+	if decoded.Values["count"] != float64(3) {
+		t.Errorf("expected numbers to come back as float64, got %#v", decoded.Values["count"])
+	}
+
+	ss.Values[1] = "non-string key"
+	if _, err := (JSONSerializer{}).Serialize(ss); err == nil {
+		t.Error("expected error for non-string key")
+	}
+}
+
+func TestSerializerMismatch(t *testing.T) {
+	ss := gsessions.NewSession(nil, sessionName)
+	ss.Values["key"] = ok
+
+	b, err := GobSerializer{}.Serialize(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var syntaxErr *json.SyntaxError
+	if err := (JSONSerializer{}).Deserialize(b, gsessions.NewSession(nil, sessionName)); !errors.As(err, &syntaxErr) {
+		t.Errorf("expected JSONSerializer to fail on gob data with a syntax error, got %v", err)
+	}
+
+	b, err = JSONSerializer{}.Serialize(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (GobSerializer{}).Deserialize(b, gsessions.NewSession(nil, sessionName)); err == nil {
+		t.Error("expected GobSerializer to fail on JSON data")
+	}
+}
+
+// newMiniRedis starts an in-memory redis server for the test and
+// returns it along with a client connected to it.
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestNewRedisStoreWithError(t *testing.T) {
+	_, client := newMiniRedis(t)
+	if _, err := NewRedisStoreWithError(client, []byte("secret")); err != nil {
+		t.Errorf("expected no error for reachable redis, got %v", err)
+	}
+
+	mr, client := newMiniRedis(t)
+	mr.Close()
+	store, err := NewRedisStoreWithError(client, []byte("secret"))
+	if err == nil || store != nil {
+		t.Fatal("expected error and no store for unreachable redis")
+	}
+	if !strings.HasPrefix(err.Error(), "redisstore: failed to reach redis: ") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestNewRedisStoreFailover(t *testing.T) {
+	opt := failoverOptions("mymaster", []string{"10.0.0.1:26379", "10.0.0.2:26379"}, "pass")
+	if opt.MasterName != "mymaster" || len(opt.SentinelAddrs) != 2 || opt.SentinelAddrs[1] != "10.0.0.2:26379" || opt.Password != "pass" {
+		t.Errorf("unexpected failover options %+v", opt)
+	}
+
+	store := NewRedisStoreFailover("mymaster", []string{"127.0.0.1:0"}, "pass", []byte("secret"))
+	defer store.Close()
+	client, isClient := store.RedisClient.(*redis.Client)
+	if !isClient || client.Options().Password != "pass" {
+		t.Errorf("expected a failover client, got %T", store.RedisClient)
+	}
+	if len(store.Codecs) != 1 {
+		t.Error("expected codecs from the key pairs")
+	}
+}
+
+func TestSetKeyPrefix(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	storeA := NewRedisStore(client, []byte("secret"))
+	storeA.SetKeyPrefix("a:sessions:")
+	storeB := NewRedisStore(client, []byte("secret"))
+	storeB.SetKeyPrefix("b:sessions:")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := storeA.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := storeA.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("a:sessions:" + session.ID) {
+		t.Errorf("expected key with prefix a:sessions: to exist")
+	}
+	if key := storeA.Key(session); key != "a:sessions:"+session.ID || !mr.Exists(key) {
+		t.Errorf("expected Key to return the saved key, got %q", key)
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if s, _ := storeA.Get(req2, sessionName); s.IsNew || s.Values["key"] != ok {
+		t.Error("expected store a to load its own session")
+	}
+	if s, _ := storeB.New(req2, sessionName); !s.IsNew || s.Values["key"] != nil {
+		t.Error("expected store b not to see the session of store a")
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.KeyFunc = func(id string) string { return "{app}:sess:" + id }
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "{app}:sess:"+session.ID {
+		t.Errorf("expected the key from KeyFunc, got %v", keys)
+	}
+	if key := store.KeyForID(session.ID); key != mr.Keys()[0] {
+		t.Errorf("expected KeyForID to return the saved key, got %q", key)
+	}
+	if key := store.Key(gsessions.NewSession(store, sessionName)); key != "" {
+		t.Errorf("expected no key for a session without ID, got %q", key)
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session, err := store.Get(req2, sessionName)
+	if err != nil || session.IsNew || session.Values["key"] != ok {
+		t.Fatalf("expected the session to load through KeyFunc, got %v", err)
+	}
+	if found, err := store.Delete(session.ID); err != nil || !found {
+		t.Errorf("expected the session to be deleted through KeyFunc, got %v, %v", found, err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys left, got %v", keys)
+	}
+}
+
+func TestSetMaxLength(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = strings.Repeat("x", 8192)
+	b, err := GobSerializer{}.Serialize(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Save(req, httptest.NewRecorder(), session)
+	var tooBig *ErrSessionTooBig
+	if !errors.As(err, &tooBig) {
+		t.Fatalf("expected ErrSessionTooBig, got %v", err)
+	}
+	if tooBig.Size != len(b) || tooBig.Limit != 4096 {
+		t.Errorf("unexpected size %d or limit %d", tooBig.Size, tooBig.Limit)
+	}
+
+	store.SetMaxLength(len(b))
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Errorf("expected session at the limit to be saved, got %v", err)
+	}
+
+	store.SetMaxLength(0)
+	session.Values["key"] = strings.Repeat("x", 65536)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Errorf("expected no limit when max length is 0, got %v", err)
+	}
+}
+
+func TestSessionMissingInRedis(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del(session.ID)
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if err != nil {
+		t.Fatalf("expected no error for a missing key, got %v", err)
+	}
+	if !session2.IsNew || session2.ID != "" || len(session2.Values) != 0 {
+		t.Error("expected a clean new session")
+	}
+}
+
+func TestExists(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	if found, err := store.Exists(req, sessionName); err != nil || found {
+		t.Errorf("no cookie: expected false, got %v, %v", found, err)
+	}
+
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if found, err := store.Exists(req2, sessionName); err != nil || !found {
+		t.Errorf("live key: expected true, got %v, %v", found, err)
+	}
+
+	mr.FastForward(time.Duration(sessionExpire+1) * time.Second)
+	if found, err := store.Exists(req2, sessionName); err != nil || found {
+		t.Errorf("expired key: expected false, got %v, %v", found, err)
+	}
+}
+
+func TestSessionRedisError(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session2, err := store.Get(req2, sessionName)
+	if !errors.Is(err, ErrRedisUnavailable) || !strings.Contains(err.Error(), "LOADING") {
+		t.Errorf("expected the redis error to be returned, got %v", err)
+	}
+	if session2.ID != session.ID {
+		t.Error("expected the session ID to be kept when redis fails")
+	}
+}
+
+// newHangingClient returns a client connected to a server that accepts
+// connections but never answers. It uses the go-redis v6 adapter, which
+// returns as soon as the context is done.
+func newHangingClient(t *testing.T) Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return NewGoRedisClient(redisv6.NewClient(&redisv6.Options{Addr: l.Addr().String()}))
+}
+
+func TestSaveWithContextCanceled(t *testing.T) {
+	store := NewRedisStoreWithClient(newHangingClient(t), []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := store.SaveWithContext(ctx, httptest.NewRecorder(), session)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected save to return promptly, took %v", elapsed)
+	}
+}
+
+func TestClose(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("expected closing again to do nothing, got %v", err)
+	}
+	if err := store.Save(req, httptest.NewRecorder(), session); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Save, got %v", err)
+	}
+	s, err := store.Get(httptest.NewRequest("GET", "/", nil), sessionName)
+	if err != ErrStoreClosed || s == nil {
+		t.Errorf("expected a session and ErrStoreClosed from Get, got %v", err)
+	}
+	ctx := context.Background()
+	if _, err := store.ExistsByID("id"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from ExistsByID, got %v", err)
+	}
+	if _, err := store.TTL("id"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from TTL, got %v", err)
+	}
+	if err := store.Touch(session); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Touch, got %v", err)
+	}
+	if _, err := store.DeleteWithContext(ctx, "id"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from DeleteWithContext, got %v", err)
+	}
+	if _, err := store.DeleteExpired(ctx, time.Hour); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from DeleteExpired, got %v", err)
+	}
+	if _, err := store.GetField(ctx, "id", "key"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from GetField, got %v", err)
+	}
+	if err := store.SetField(ctx, "id", "key", ok); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from SetField, got %v", err)
+	}
+	if _, err := store.ListSessionIDs(ctx); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from ListSessionIDs, got %v", err)
+	}
+	if err := store.Flush(ctx); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Flush, got %v", err)
+	}
+	if _, err := store.Count(ctx); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Count, got %v", err)
+	}
+	if _, _, err := store.Scan(ctx, 0, 10); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Scan, got %v", err)
+	}
+	if err := store.Ping(ctx); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from Ping, got %v", err)
+	}
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("expected the client of the caller to be left open, got %v", err)
+	}
+
+	owned := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store, err = NewRedisStoreWithOptions(owned, WithKeyPairs([]byte("secret")), WithOwnedClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := owned.Ping(context.Background()).Err(); err != redis.ErrClosed {
+		t.Errorf("expected the owned client to be closed, got %v", err)
+	}
+}
+
+func TestCloseGoroutines(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store, err := NewRedisStoreWithOptions(client, WithKeyPairs([]byte("secret")), WithOwnedClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := sessionRouter(store)
+	cookie := serve(r, "/set?v=leak", nil).Header().Get("Set-Cookie")
+	if res := serve(r, "/get", http.Header{"Cookie": {cookie}}); res.Body.String() != "leak" {
+		t.Fatalf("expected the session, got %q", res.Body.String())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetMaxLengthRaised(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetMaxLength(16384)
+	store.SetMaxLength(-1)
+	if store.maxLength != 16384 {
+		t.Errorf("expected negative max length to be ignored, got %d", store.maxLength)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = strings.Repeat("x", 8192)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Errorf("expected payload above the default limit to be saved, got %v", err)
+	}
+}
+
+func TestSetSameSite(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetSameSite(http.SameSiteNoneMode)
+	store.Options(sessions.Options{Path: "/", Secure: true})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	cookie := res.Header().Get("Set-Cookie")
+	if !strings.Contains(cookie, "Secure") || !strings.Contains(cookie, "SameSite=None") {
+		t.Errorf("expected SameSite=None and Secure in %q", cookie)
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetSameSite(http.SameSiteStrictMode)
+	r := gin.Default()
+	r.Use(sessions.Sessions(sessionName, store))
+	r.GET("/set", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+
+	get := func() *http.Cookie {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/set", nil)
+		r.ServeHTTP(res, req)
+		cookies := res.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected 1 cookie, got %d", len(cookies))
+		}
+		return cookies[0]
+	}
+	if c := get(); c.Path != "/" || c.MaxAge != sessionExpire {
+		t.Errorf("unexpected default cookie %+v", c)
+	}
+
+	// changed after the middleware was set up
+	store.Options(sessions.Options{Path: "/app", Domain: "example.com", MaxAge: 60, Secure: true, HttpOnly: true})
+	c := get()
+	if c.Path != "/app" || c.Domain != "example.com" || c.MaxAge != 60 || !c.Secure || !c.HttpOnly {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+	if c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("expected SameSite to be kept, got %v", c.SameSite)
+	}
+}
+
+func TestStoreOptionsConcurrent(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.Options(sessions.Options{Path: "/", MaxAge: i + 1})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if _, err := store.New(req, sessionName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+// TestSetMaxAgeConcurrent is meant to be run with -race.
+func TestSetMaxAgeConcurrent(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	stop := make(chan struct{})
+	flipped := make(chan struct{})
+	go func() {
+		defer close(flipped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := store.SetMaxAge(60 + i%2); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, err := store.Get(req, sessionName)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				session.Values["key"] = i
+				res := httptest.NewRecorder()
+				if err := store.Save(req, res, session); err != nil {
+					t.Error(err)
+					return
+				}
+				req2, _ := http.NewRequest("GET", "/", nil)
+				req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+				if session, err := store.Get(req2, sessionName); err != nil || session.IsNew {
+					t.Errorf("expected the saved session, got %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-flipped
+	if age := store.RedisStore.Options.MaxAge; age != 60 && age != 61 {
+		t.Errorf("unexpected max age %d", age)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	if existed, err := store.Delete(session.ID); err != nil || !existed {
+		t.Errorf("expected session to be deleted, got %v, %v", existed, err)
+	}
+	if existed, err := store.Delete(session.ID); err != nil || existed {
+		t.Errorf("expected second delete to be a no-op, got %v, %v", existed, err)
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if session2, err := store.Get(req2, sessionName); err != nil || !session2.IsNew {
+		t.Errorf("expected a new session after delete, got %v", err)
+	}
+}
+
+// plainCodec is a securecookie.Codec without a max age.
+type plainCodec struct{}
+
+func (plainCodec) Encode(name string, value interface{}) (string, error) {
+	return fmt.Sprint(value), nil
+}
+
+func (plainCodec) Decode(name, value string, dst interface{}) error {
+	*dst.(*string) = value
+	return nil
+}
+
+func TestRotateKeys(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("old-secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	store.RotateKeys([]byte("new-secret"))
+	s, err := store.New(requestWith(res), sessionName)
+	if err != nil || s.Values["key"] != ok {
+		t.Fatalf("expected the cookie signed with the old key to decode, got %v", err)
+	}
+	res2 := httptest.NewRecorder()
+	if err := store.Save(req, res2, s); err != nil {
+		t.Fatal(err)
+	}
+	cookie := res2.Result().Cookies()[0].Value
+	var id string
+	newOnly := securecookie.CodecsFromPairs([]byte("new-secret"))
+	if err := securecookie.DecodeMulti(sessionName, cookie, &id, newOnly...); err != nil || id != session.ID {
+		t.Errorf("expected the cookie to be signed with the new key, got %q (%v)", id, err)
+	}
+	fresh := NewRedisStore(client, []byte("new-secret"))
+	if s, err := fresh.New(requestWith(res2), sessionName); err != nil || s.Values["key"] != ok {
+		t.Errorf("expected a store with the new key only to read the new cookie, got %v", err)
+	}
+}
+
+func TestSetMaxAge(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.SetMaxAge(-1); err == nil {
+		t.Error("expected error for a negative max age")
+	}
+	if err := store.SetMaxAge(0); err != nil {
+		t.Errorf("expected zero to be accepted, got %v", err)
+	}
+
+	store.Codecs = append(store.Codecs, plainCodec{})
+	err := store.SetMaxAge(100)
+	if err == nil || !strings.Contains(err.Error(), "plainCodec") {
+		t.Errorf("expected error naming the unsupported codec, got %v", err)
+	}
+	if store.RedisStore.Options.MaxAge != 100 {
+		t.Error("expected max age to be set despite the unsupported codec")
+	}
+}
+
+func TestRefreshOnGet(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.RefreshOnGet = true
+	store.SetMaxAge(100)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		mr.FastForward(60 * time.Second)
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		if s, err := store.Get(req, sessionName); err != nil || s.IsNew {
+			t.Fatalf("expected session to be alive after %d reads, got %v", i, err)
+		}
+		if ttl := mr.TTL(session.ID); ttl != 100*time.Second {
+			t.Errorf("expected TTL to be refreshed to 100s, got %v", ttl)
+		}
+	}
+}
+
+func TestRegenerateID(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res1 := httptest.NewRecorder()
+	if err := store.Save(req, res1, session); err != nil {
+		t.Fatal(err)
+	}
+	oldID := session.ID
+
+	res2 := httptest.NewRecorder()
+	if err := store.RegenerateID(req, res2, session); err != nil {
+		t.Fatal(err)
+	}
+	if session.ID == oldID {
+		t.Fatal("expected a new session ID")
+	}
+	if mr.Exists(oldID) {
+		t.Error("expected old key to be deleted")
+	}
+
+	req1, _ := http.NewRequest("GET", "/", nil)
+	req1.Header.Set("Cookie", res1.Header().Get("Set-Cookie"))
+	if s, _ := store.Get(req1, sessionName); !s.IsNew || s.Values["key"] != nil {
+		t.Error("expected old cookie to no longer resolve to any data")
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res2.Header().Get("Set-Cookie"))
+	if s, _ := store.Get(req2, sessionName); s.IsNew || s.Values["key"] != ok {
+		t.Error("expected new cookie to resolve to the session values")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetMaxAge(100)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	client.AddHook(commandHook(func(cmd redis.Cmder) { sent = append(sent, cmd.Name()) }))
+	mr.FastForward(90 * time.Second)
+	if err := store.Touch(session); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(session.ID); ttl != 100*time.Second {
+		t.Errorf("expected TTL to be extended to 100s, got %v", ttl)
+	}
+	if len(sent) != 1 || sent[0] != "expire" {
+		t.Errorf("expected a single EXPIRE, got %v", sent)
+	}
+
+	mr.FastForward(101 * time.Second)
+	if err := store.Touch(session); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+// commandHook is a redis hook calling itself with every command sent.
+type commandHook func(cmd redis.Cmder)
+
+func (h commandHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h commandHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h(cmd)
+		return next(ctx, cmd)
+	}
+}
+
+func (h commandHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h(cmd)
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// countBytes makes client add the size of the arguments of every command
+// it sends to n.
+func countBytes(client *redis.Client, n *int64) {
+	client.AddHook(commandHook(func(cmd redis.Cmder) {
+		for _, arg := range cmd.Args() {
+			switch arg := arg.(type) {
+			case []byte:
+				*n += int64(len(arg))
+			default:
+				*n += int64(len(fmt.Sprint(arg)))
+			}
+		}
+	}))
+}
+
+func benchmarkReadHeavy(b *testing.B, touch bool) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	var written int64
+	countBytes(client, &written)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = strings.Repeat("x", 2048)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		b.Fatal(err)
+	}
+
+	written = 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if touch {
+			err = store.Touch(session)
+		} else {
+			err = store.Save(req, httptest.NewRecorder(), session)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(written)/float64(b.N), "redis-bytes/op")
+}
+
+func BenchmarkReadHeavySave(b *testing.B)  { benchmarkReadHeavy(b, false) }
+func BenchmarkReadHeavyTouch(b *testing.B) { benchmarkReadHeavy(b, true) }
+
+func TestRegenerateIDCookieOnSave(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	oldID := session.ID
+	if err := store.RegenerateID(req, nil, session); err != nil {
+		t.Fatal(err)
+	}
+
+	old := gsessions.NewSession(store, sessionName)
+	old.ID = oldID
+	if found, err := store.load(context.Background(), old); err != nil || found {
+		t.Errorf("expected old ID to no longer load, got %v, %v", found, err)
+	}
+	regenerated := gsessions.NewSession(store, sessionName)
+	regenerated.ID = session.ID
+	if found, err := store.load(context.Background(), regenerated); err != nil || !found || regenerated.Values["key"] != ok {
+		t.Errorf("expected new ID to load the same values, got %v, %v", found, err)
+	}
+
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	if s, _ := store.Get(req2, sessionName); s.ID != session.ID {
+		t.Error("expected next Save to set the cookie with the new ID")
+	}
+}
 
+func TestGetRequestContextCanceled(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+
+	store.cmd = newHangingClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2 = req2.WithContext(ctx)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	start := time.Now()
+	if _, err := store.Get(req2, sessionName); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected get to return promptly, took %v", elapsed)
+	}
+}
+
+func TestLoadByID(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	r := sessionRouter(store)
+
+	cookie := serve(r, "/set?v=browser", nil).Header().Get("Set-Cookie")
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", cookie)
+	session, _ := store.Get(req, sessionName)
+
+	worker, err := store.LoadByID(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worker.IsNew || worker.Values["key"] != "browser" {
+		t.Errorf("expected the browser session, got %v", worker.Values)
+	}
+	worker.Values["key"] = "worker"
+	if err := store.SaveByID(worker); err != nil {
+		t.Fatal(err)
+	}
+	if res := serve(r, "/get", http.Header{"Cookie": {cookie}}); res.Body.String() != "worker" {
+		t.Errorf("expected the browser to see the change, got %q", res.Body.String())
+	}
+
+	if _, err := store.LoadByID("missing"); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+	if err := store.SaveByID(gsessions.NewSession(store, sessionName)); err == nil {
+		t.Error("expected error saving a session without ID")
+	}
+}
+
+func TestRawGet(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetKeyPrefix("raw:")
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.RawGet(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := mr.Get("raw:" + session.ID); string(data) != stored {
+		t.Error("expected the stored bytes")
+	}
+	s := gsessions.NewSession(store, sessionName)
+	if err := (GobSerializer{}).Deserialize(data, s); err != nil || s.Values["key"] != ok {
+		t.Errorf("expected the serializer to decode the stored bytes, got %v, %v", s.Values, err)
+	}
+
+	if _, err := store.RawGet(ctx, "missing"); err != ErrSessionNotFound {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+	mr.Close()
+	if _, err := store.RawGet(ctx, session.ID); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable, got %v", err)
+	}
+	store.Close()
+	if _, err := store.RawGet(ctx, session.ID); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed, got %v", err)
+	}
+}
+
+func TestLoadMany(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			counting := &countingClient{Client: c}
+			store := NewRedisStoreWithClient(counting, []byte("secret"))
+			var ids []string
+			for _, v := range []string{"a", "b", "c"} {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				session.Values["key"] = v
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, session.ID)
+			}
+			mr.Set(ids[2], "garbage")
+
+			counting.gets = 0
+			loaded, err := store.LoadMany(context.Background(), append(ids, "missing"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counting.pipelines != 1 || counting.gets != 0 {
+				t.Errorf("expected a single round trip, got %d pipelines and %d GETs", counting.pipelines, counting.gets)
+			}
+			if len(loaded) != 2 || loaded[ids[0]].Values["key"] != "a" || loaded[ids[1]].Values["key"] != "b" {
+				t.Fatalf("expected the sessions a and b, got %v", loaded)
+			}
+			if mr.Exists(ids[2]) {
+				t.Error("expected the corrupt session to be deleted")
+			}
+			session := loaded[ids[0]]
+			session.Values["key"] = "a2"
+			if err := store.SaveByID(session); err != nil {
+				t.Fatal(err)
+			}
+			if s, _ := store.LoadByID(ids[0]); s.Values["key"] != "a2" {
+				t.Errorf("expected the session to be saved by ID, got %v", s.Values)
+			}
+		})
+	}
+}
+
+func TestLoadManyFallback(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStoreWithClient(struct{ Client }{NewGoRedisV9Client(client)}, []byte("secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.LoadMany(context.Background(), []string{session.ID, "missing"})
+	if err != nil || len(loaded) != 1 || loaded[session.ID].Values["key"] != ok {
+		t.Errorf("expected the session without pipelining, got %v, %v", loaded, err)
+	}
+}
+
+func TestDeleteWithContext(t *testing.T) {
+	store := NewRedisStoreWithClient(newHangingClient(t), []byte("secret"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := store.DeleteWithContext(ctx, "id"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("expected ping to succeed, got %v", err)
+	}
+	mr.Close()
+	if err := store.Ping(context.Background()); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("expected ErrRedisUnavailable, got %v", err)
+	}
 }
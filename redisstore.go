@@ -2,18 +2,25 @@ package redisstore
 
 import (
 	"bytes"
-	"encoding/base32"
+	"context"
+	"crypto/cipher"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	ginsessions "github.com/gin-gonic/contrib/sessions"
-	"github.com/go-redis/redis"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // SessionSerializer provides an interface hook for alternative serializers
@@ -36,7 +43,10 @@ func (s GobSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
 	return nil, err
 }
 
-type store struct {
+// Store is the gin sessions store returned by NewRedisStore.
+// It wraps a RedisStore and adds the gin Options method. Use it through the
+// pointer returned by the constructors.
+type Store struct {
 	*RedisStore
 }
 
@@ -46,136 +56,1287 @@ func (s GobSerializer) Deserialize(d []byte, ss *sessions.Session) error {
 	return dec.Decode(&ss.Values)
 }
 
-// Amount of time for cookies/redis keys to expire.
-var sessionExpire = 86400 * 30
+// JSONSerializer uses encoding/json to encode the session map
+// Only string keys are supported. Numbers are decoded back as float64,
+// as done by encoding/json for interface{} values.
+type JSONSerializer struct{}
+
+// Serialize to JSON. Will err if there are unmarshalable key values
+func (s JSONSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	m, err := stringKeys(ss, "JSON")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// stringKeys returns the session values keyed by string, for serializers
+// of the given format which only support string keys.
+func stringKeys(ss *sessions.Session, format string) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(ss.Values))
+	for k, v := range ss.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("redisstore: non-string key value %#v, cannot serialize session to %s", k, format)
+		}
+		m[ks] = v
+	}
+	return m, nil
+}
+
+// Deserialize back to map[string]interface{}
+func (s JSONSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(d, &m); err != nil {
+		return fmt.Errorf("redisstore: cannot deserialize session from JSON: %w", err)
+	}
+	for k, v := range m {
+		ss.Values[k] = v
+	}
+	return nil
+}
+
+// Default max age in seconds of cookies and redis keys, each store having its
+// own copy in Options.MaxAge.
+const sessionExpire = 86400 * 30
 
 type RedisStore struct {
-	RedisClient   redis.UniversalClient
-	Options       *sessions.Options // default configuration
+	RedisClient redis.UniversalClient
+	// Options is the default configuration of session cookies, copied into
+	// new sessions. Store.Options, SetSameSite and SetMaxAge replace it
+	// safely while requests are served; like the other exported fields, it
+	// can only be changed directly before the store is used.
+	Options       *sessions.Options
 	Codecs        []securecookie.Codec
 	keyPrefix     string
 	serializer    SessionSerializer
 	maxLength     int
 	DefaultMaxAge int
+	// RefreshOnGet extends the redis TTL of a session every time it is loaded.
+	RefreshOnGet bool
+	// StrictDecode makes New return ErrDecodeFailed for sessions that can't
+	// be decoded, along with a new session without an ID, while the corrupt
+	// record is kept in redis. By default such sessions are deleted and a
+	// new session is returned.
+	StrictDecode bool
+	// OnCorruptSession, if set, is called with the ID of sessions that
+	// can't be decoded and the decoding error.
+	OnCorruptSession func(id string, err error)
+	// OnFingerprintMismatch, if set, is called with the ID of sessions
+	// loaded for a client with another fingerprint, see SetFingerprint, and
+	// both fingerprints.
+	OnFingerprintMismatch func(id, got, want string)
+	// KeyFunc, if set, returns the redis key of the session id instead of
+	// the key prefix followed by id, e.g. to add a cluster hash tag or a
+	// tenant. The user index of a user ID and the set of a tag are stored
+	// under the keys of "user:" followed by the ID and "tag:" followed by
+	// the tag. Count and Flush only see keys under the key prefix, which
+	// KeyFunc should then start with. Keys can't be turned back into IDs, so
+	// ListSessionIDs, Scan, ForEachSession and the DeleteAll, DeleteWhere and
+	// DeleteExpired sweeps fail. Set it with SetKeyFunc once the store is
+	// used.
+	KeyFunc func(id string) string
+	// SchemaVersion, if positive, is saved with the values of sessions.
+	// Sessions saved with a newer version are not loaded, and are left in
+	// redis; sessions without a version have version zero.
+	SchemaVersion int
+	// MinSchemaVersion is the oldest schema version loaded when
+	// SchemaVersion is set. Older sessions are deleted.
+	MinSchemaVersion int
+	// MigrateSession, if set, is called with sessions loaded with a schema
+	// version older than SchemaVersion, and the version, to update their
+	// values. They are saved with SchemaVersion by the next Save.
+	MigrateSession func(session *sessions.Session, version int) error
+
+	compress        bool
+	aead            cipher.AEAD
+	skipUnchanged   bool
+	cmd             Client // set when not built from RedisClient
+	newID           IDGenerator
+	idLength        int
+	idEncoding      IDEncoding
+	observer        Observer
+	logger          Logger
+	metrics         Metrics
+	tracerProvider  trace.TracerProvider
+	healthTimeout   time.Duration
+	healthProbe     bool
+	ttlJitter       time.Duration
+	coalesce        bool
+	readOnly        bool
+	compressMin     int  // sessions up to this size aren't compressed
+	metadata        bool // sessions record their creation and last access
+	fingerprint     func(r *http.Request) string
+	lockWait        time.Duration
+	deleteBatch     int                // keys per round trip of DeleteAll and DeleteWhere
+	loads           singleflight.Group // concurrent loads if coalesce is set
+	fallback        sessions.Store     // keeps sessions while redis is unavailable
+	cache           *localCache
+	invalidation    *invalidation // of the caches of other instances
+	listeners       listeners     // started by StartExpiryListener
+	ownsClient      bool          // Close closes the client
+	db              *int          // database selected by WithDB
+	databases       int           // of the server, bounding db
+	closed          bool
+	storage         StorageMode
+	userKey         string
+	maxUserSessions int
+	eviction        EvictionPolicy
+	idleTimeout     time.Duration
+	absoluteMaxAge  time.Duration
+	renewal         time.Duration
+	versionCheck    bool
+	clock           Clock
+	tokenHeader     string // carries the session ID instead of a cookie if set
+
+	// mu is held for writing by the setters and for reading by requests,
+	// so settings can be changed while sessions are used. Setters wait for
+	// the requests in flight, and must not be called from observers or
+	// other callbacks of the store.
+	mu sync.RWMutex
+}
+
+// NewRedisStore returns a store backed by redisClient, see
+// NewRedisStoreWithOptions. Unlike the latter, it accepts no key pairs, in
+// which case sessions fail to be encoded until Codecs are set.
+func NewRedisStore(redisClient redis.UniversalClient, keyPairs ...[]byte) *Store {
+	store, err := NewRedisStoreWithOptions(redisClient, WithKeyPairs(keyPairs...))
+	if err != nil {
+		// missing key pairs are the only error of these options
+		return &Store{newDefaultRedisStore(redisClient)}
+	}
+	return store
+}
+
+// NewRedisStoreV9 returns a store backed by a github.com/redis/go-redis/v9
+// client.
+//
+// Deprecated: NewRedisStore takes a v9 client now.
+func NewRedisStoreV9(redisClient redis.UniversalClient, keyPairs ...[]byte) *Store {
+	return NewRedisStore(redisClient, keyPairs...)
 }
 
-func NewRedisStore(redisClient redis.UniversalClient, keyPairs ...[]byte) store {
-	rs := &RedisStore{
+// NewRedisStoreWithClient returns a store running its redis commands with c.
+func NewRedisStoreWithClient(c Client, keyPairs ...[]byte) *Store {
+	rs := newDefaultRedisStore(nil)
+	rs.cmd = c
+	rs.Codecs = securecookie.CodecsFromPairs(keyPairs...)
+	return &Store{rs}
+}
+
+// NewRedisStoreFailover returns a store backed by the redis master named
+// masterName, found through the sentinels at sentinelAddrs, following it
+// when it fails over. password is the one of the redis servers.
+func NewRedisStoreFailover(masterName string, sentinelAddrs []string, password string, keyPairs ...[]byte) *Store {
+	s := NewRedisStore(redis.NewFailoverClient(failoverOptions(masterName, sentinelAddrs, password)), keyPairs...)
+	s.ownsClient = true
+	return s
+}
+
+// failoverOptions returns the options of the client of NewRedisStoreFailover.
+func failoverOptions(masterName string, sentinelAddrs []string, password string) *redis.FailoverOptions {
+	return &redis.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: sentinelAddrs,
+		Password:      password,
+	}
+}
+
+// client returns the redis commands used by the store.
+func (rs *RedisStore) client() Client {
+	if rs.cmd != nil {
+		return rs.cmd
+	}
+	return goRedisV9{rs.RedisClient}
+}
+
+// newDefaultRedisStore returns a RedisStore with default settings and no codecs.
+func newDefaultRedisStore(redisClient redis.UniversalClient) *RedisStore {
+	return &RedisStore{
 		RedisClient: redisClient,
-		Codecs:      securecookie.CodecsFromPairs(keyPairs...),
 		Options: &sessions.Options{
 			Path:   "/",
 			MaxAge: sessionExpire,
 		},
 		serializer:    GobSerializer{},
 		maxLength:     4096,
+		clock:         realClock{},
+		cache:         newLocalCache(),
+		databases:     DefaultDatabases,
 		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
 	}
-	return store{rs}
+}
+
+// Amount of time NewRedisStoreWithError waits for redis to answer a ping.
+var pingTimeout = 5 * time.Second
+
+// NewRedisStoreWithError is like NewRedisStore but pings redis first,
+// so an unreachable server is reported at startup instead of on first use.
+func NewRedisStoreWithError(redisClient redis.UniversalClient, keyPairs ...[]byte) (*Store, error) {
+	rs := NewRedisStore(redisClient, keyPairs...)
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := rs.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("redisstore: failed to reach redis: %w", err)
+	}
+	return rs, nil
+}
+
+// Ping checks that redis can be reached, e.g. for readiness probes.
+// The error returned wraps ErrRedisUnavailable, or is ErrStoreClosed once
+// the store is closed.
+func (rs *RedisStore) Ping(ctx context.Context) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	return rs.ping(ctx)
+}
+
+// ping checks that redis can be reached, with Ping if the client has it.
+func (rs *RedisStore) ping(ctx context.Context) error {
+	if c, ok := rs.client().(interface{ Ping(context.Context) error }); ok {
+		return unavailable(c.Ping(ctx))
+	}
+	_, err := rs.client().Exists(ctx, rs.keyPrefix)
+	return unavailable(err)
+}
+
+// Close closes the store. Sessions can't be loaded or saved after it, which
+// returns ErrStoreClosed. The redis client is closed too if the store owns
+// it: if it was created by the store, as by NewRedisStoreFailover and
+// WithDB, or given with WithOwnedClient. Calling Close again does nothing.
+func (rs *RedisStore) Close() error {
+	rs.listeners.stop() // first, their callbacks may use the store
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed {
+		return nil
+	}
+	rs.closed = true
+	if err := rs.unsubscribe(); err != nil {
+		rs.log(context.Background(), slog.LevelWarn, "redisstore: closing cache invalidation", "error", err)
+	}
+	if c, ok := rs.client().(io.Closer); ok && rs.ownsClient {
+		return c.Close()
+	}
+	return nil
+}
+
+// open returns ErrStoreClosed once the store is closed.
+func (rs *RedisStore) open() error {
+	if rs.closed {
+		return ErrStoreClosed
+	}
+	return nil
 }
 
 // Get returns a session for the given name
 // It returns a new session if there are no sessions  for the name.
+// Sessions are kept in the request registry of gorilla/sessions, so only the
+// first Get of a name in a request loads it from redis; later calls, e.g. from
+// other middleware, return the same session. Use New to load it again.
 func (rs *RedisStore) Get(r *http.Request, name string) (*sessions.Session, error) {
-	return rs.New(r, name)
+	return sessions.GetRegistry(r).Get(rs.registered(r, name), name)
 }
+
+// New returns a session for the given name without adding it to the registry.
+// Redis is queried with the context of r.
+// A cookie that can't be decoded, e.g. tampered with or signed by a retired
+// key pair, gives a fresh session along with an error matching
+// ErrInvalidCookie; saving the session issues a new ID.
 func (rs *RedisStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	return rs.NewWithContext(r.Context(), r, name)
+}
+
+// NewWithContext is like New but queries redis with ctx.
+func (rs *RedisStore) NewWithContext(ctx context.Context, r *http.Request, name string) (*sessions.Session, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.newSession(ctx, r, name, &sessionState{RedisStore: rs})
+}
+
+// newSession is NewWithContext with st as the store of the session.
+func (rs *RedisStore) newSession(ctx context.Context, r *http.Request, name string, st *sessionState) (*sessions.Session, error) {
 	var (
 		err error
 		ok  bool
 	)
-	session := sessions.NewSession(rs, name)
-	options := *rs.Options
+	session := sessions.NewSession(st, name)
+	options := *rs.Options // copied, later changes don't affect session
 	session.Options = &options
 	session.IsNew = true
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, rs.Codecs...)
-		if err == nil {
-			ok, err = rs.load(session)
+	if err := rs.open(); err != nil {
+		return session, err
+	}
+	if value := rs.readID(r, name); value != "" {
+		var id string
+		if err = securecookie.DecodeMulti(name, value, &id, rs.Codecs...); err != nil {
+			// the session stays a fresh one, without anything of the cookie
+			rs.log(ctx, slog.LevelDebug, "redisstore: invalid session cookie", "name", name, "error", err)
+			err = invalidCookie(err)
+		} else {
+			session.ID = id
+			ok, err = rs.load(ctx, session)
+			if errors.Is(err, ErrDecodeFailed) {
+				err = rs.corrupt(ctx, session, err)
+				ok = false
+			}
+			if ok && err == nil && !rs.checkFingerprint(r, session, st) {
+				ok = false // another client, start over like for expired sessions
+			}
 			session.IsNew = !(err == nil && ok) // not new if no error and data available
+			if !ok && (err == nil || errors.Is(err, ErrDecodeFailed)) {
+				// expired or corrupt in redis, start over with a fresh ID, so
+				// saving the session never overwrites a record kept by
+				// StrictDecode
+				session.ID = ""
+				session.Values = make(map[interface{}]interface{})
+			}
+			if !session.IsNew {
+				st.id, st.options = session.ID, *session.Options
+			}
 		}
 	}
-	return session, err
+	if session.IsNew && rs.fingerprint != nil {
+		st.fingerprint = rs.fingerprint(r)
+	}
+	return session, rs.loadFallback(ctx, r, session, err)
+}
+
+// Exists reports whether r carries a cookie, or a token in token mode, for a
+// session named name that is still stored in redis, without loading the
+// session. Missing, invalid or expired cookies and sessions expired in redis
+// report false.
+func (rs *RedisStore) Exists(r *http.Request, name string) (bool, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return false, err
+	}
+	id := rs.requestID(r, name)
+	if id == "" {
+		return false, nil
+	}
+	found, err := rs.client().Exists(r.Context(), rs.key(id))
+	if err != nil {
+		return false, unavailable(err)
+	}
+	return found, nil
 }
 
+// corrupt handles a session that failed to decode with err. Unless the
+// store is strict, the session is reset, deleted unless the request is
+// read-only, and nil is returned.
+func (rs *RedisStore) corrupt(ctx context.Context, session *sessions.Session, err error) error {
+	if rs.OnCorruptSession != nil {
+		rs.OnCorruptSession(session.ID, err)
+	}
+	if rs.StrictDecode {
+		return err
+	}
+	session.Values = make(map[interface{}]interface{})
+	if rs.readOnlyCtx(ctx) {
+		rs.log(ctx, slog.LevelWarn, "redisstore: ignoring corrupt session", "id", session.ID, "error", err)
+		return nil
+	}
+	rs.log(ctx, slog.LevelWarn, "redisstore: deleting corrupt session", "id", session.ID, "error", err)
+	return rs.delete(ctx, session)
+}
+
+// Save adds a single session to the response.
+// Redis is queried with the context of r.
 func (rs *RedisStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return rs.SaveWithContext(r.Context(), w, session)
+}
+
+// SaveWithContext is like Save but queries redis with ctx.
+func (rs *RedisStore) SaveWithContext(ctx context.Context, w http.ResponseWriter, session *sessions.Session) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if rs.readOnlyCtx(ctx) {
+		return rs.saveReadOnly(w, session)
+	}
+	delete(session.Values, FallbackKey) // back in redis once saved
+	if err := rs.persist(ctx, session); err != nil {
+		if err := rs.saveFallback(ctx, w, session, err); err != nil {
+			return err
+		}
+		if session.Options.MaxAge < 0 {
+			rs.writeID(w, session, "")
+		}
+		return nil
+	}
+	if rs.fallback != nil {
+		if err := rs.writeFallback(w, session); err != nil {
+			rs.log(ctx, slog.LevelWarn, "redisstore: saving session copy to the fallback store", "name", session.Name(), "error", err)
+		}
+	}
 	// Marked for deletion.
 	if session.Options.MaxAge < 0 {
-		if err := rs.delete(session); err != nil {
+		rs.writeID(w, session, "")
+		return nil
+	}
+	st := rs.state(session)
+	if rs.skipUnchanged && st != nil && st.cookieUnchanged(session) {
+		return nil
+	}
+	encoded, err := rs.encodeID(session)
+	if err != nil {
+		return err
+	}
+	rs.writeID(w, session, encoded)
+	return nil
+}
+
+// saveReadOnly sets the cookie of a loaded session like Save, without
+// writing the session to redis.
+func (rs *RedisStore) saveReadOnly(w http.ResponseWriter, session *sessions.Session) error {
+	st := rs.state(session)
+	if session.ID == "" || session.Options.MaxAge < 0 || rs.skipUnchanged && st != nil && st.cookieUnchanged(session) {
+		return nil
+	}
+	encoded, err := rs.encodeID(session)
+	if err != nil {
+		return err
+	}
+	rs.writeID(w, session, encoded)
+	return nil
+}
+
+// SaveToken saves session like Save, but returns its signed ID instead of
+// writing it to a response, for code without one, e.g. gRPC services or
+// background jobs handing the token to a client. The token is the value of
+// the cookie Save would set, so New reads it back from a cookie, or from the
+// header in token mode. Deleting a session, with a negative MaxAge, returns
+// an empty token. A read-only store writes nothing, returning the token of
+// loaded sessions only, like Save.
+func (rs *RedisStore) SaveToken(session *sessions.Session) (string, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return "", err
+	}
+	if rs.readOnly {
+		if session.ID == "" || session.Options.MaxAge < 0 {
+			return "", nil
+		}
+		return rs.encodeID(session)
+	}
+	if err := rs.persist(context.Background(), session); err != nil {
+		return "", err
+	}
+	if session.Options.MaxAge < 0 {
+		return "", nil
+	}
+	return rs.encodeID(session)
+}
+
+// persist writes session to redis, or deletes it if its MaxAge is negative,
+// and updates the index of its user and the sets of its tags.
+func (rs *RedisStore) persist(ctx context.Context, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if err := rs.delete(ctx, session); err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		if err := rs.unindex(ctx, session, session.ID); err != nil {
+			return err
+		}
+		return rs.untag(ctx, session, session.ID)
+	}
+	dropFlashes(session)
+	if err := rs.admit(ctx, session); err != nil {
+		return err
+	}
+	var err error
+	if session.ID == "" {
+		err = rs.create(ctx, session)
 	} else {
-		// Build an alphanumeric key for the redis store.
-		if session.ID == "" {
-			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		err = rs.save(ctx, session, false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := rs.index(ctx, session); err != nil {
+		return err
+	}
+	return rs.tag(ctx, session)
+}
+
+// encodeID returns the signed ID of session handed to the client, and keeps
+// track of it in the state of session.
+func (rs *RedisStore) encodeID(session *sessions.Session) (string, error) {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, rs.Codecs...)
+	if err != nil {
+		return "", err
+	}
+	if st := rs.state(session); st != nil {
+		st.id, st.options = session.ID, *session.Options
+	}
+	return encoded, nil
+}
+
+// RegenerateID moves the session to a new ID, keeping its values but its
+// CSRF token, which is replaced, and sets the new cookie; use it after login
+// to prevent session fixation.
+// The new key is written before the old one is deleted, in a single
+// transaction, or two commands in HashMode. Like for new sessions, IDs
+// already taken in redis are never overwritten: other IDs are tried, and
+// *ErrIDCollision is returned if they are all taken. If w is nil, the cookie
+// is set by the next Save. It returns ErrReadOnly for read-only requests.
+func (rs *RedisStore) RegenerateID(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if err := rs.writable(r.Context()); err != nil {
+		return err
+	}
+	token, rotate := session.Values[csrfKey]
+	if rotate {
+		if _, err := newCSRFToken(session); err != nil {
+			return err
 		}
-		if err := rs.save(session); err != nil {
+	}
+	ctx, oldID := r.Context(), session.ID
+	newID, size, err := rs.regenerate(ctx, session)
+	if err != nil {
+		if rotate {
+			session.Values[csrfKey] = token // still the stored one
+		}
+		return err
+	}
+	session.ID = newID
+	rs.observe().OnSave(newID, size)
+	if err := rs.index(ctx, session); err != nil {
+		return err
+	}
+	if err := rs.tag(ctx, session); err != nil {
+		return err
+	}
+	if oldID != "" {
+		rs.observe().OnDelete(oldID)
+		if err := rs.unindex(ctx, session, oldID); err != nil {
 			return err
 		}
-		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, rs.Codecs...)
-		if err != nil {
+		if err := rs.untag(ctx, session, oldID); err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
 	}
+	if w == nil {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, rs.Codecs...)
+	if err != nil {
+		return err
+	}
+	rs.writeID(w, session, encoded)
 	return nil
 }
 
+// move writes session under newID and deletes its old key, and returns the
+// size of the stored data, or errIDTaken if newID is already used in redis.
+func (rs *RedisStore) move(ctx context.Context, session *sessions.Session, newID string) (int, error) {
+	defer rs.stamp(session)()
+	if rs.storage == HashMode {
+		if err := rs.taken(ctx, rs.key(newID)); err != nil {
+			return 0, err
+		}
+		size, err := rs.saveHash(ctx, newID, session)
+		if err != nil || session.ID == "" {
+			return size, err
+		}
+		_, err = rs.client().Del(ctx, rs.key(session.ID))
+		return size, unavailable(err)
+	}
+
+	b, err := rs.serialize(newID, session)
+	if err != nil {
+		return 0, err
+	}
+	var version []byte
+	if rs.versioned() {
+		// the session starts over at version zero under its new ID
+		version = make([]byte, versionSize)
+		b = append(version, b...)
+	}
+	if err := rs.setDel(ctx, rs.key(newID), b, rs.ttl(session), session.ID); err != nil {
+		return 0, err
+	}
+	if st := rs.state(session); st != nil && version != nil {
+		st.version = version
+	}
+	rs.written(session)
+	if session.ID != "" {
+		rs.invalidate(ctx, rs.key(session.ID))
+	}
+	return len(b), nil
+}
+
+// setDel sets key, the key of a session moved to a new ID, unless it exists,
+// and deletes the session oldID, if any, in a single step if the client
+// supports it. It returns errIDTaken if key exists.
+func (rs *RedisStore) setDel(ctx context.Context, key string, b []byte, ttl time.Duration, oldID string) error {
+	type setDeler interface {
+		SetDel(ctx context.Context, key string, value []byte, ttl time.Duration, oldKey string) error
+	}
+	if oldID == "" {
+		return rs.setNew(ctx, key, b, ttl)
+	}
+	oldKey := rs.key(oldID)
+	if c, ok := rs.client().(setNXDeler); ok {
+		set, err := c.SetNXDel(ctx, key, b, ttl, oldKey)
+		if err != nil {
+			return unavailable(err)
+		}
+		if !set {
+			return errIDTaken
+		}
+		return nil
+	}
+	if err := rs.taken(ctx, key); err != nil {
+		return err
+	}
+	if c, ok := rs.client().(setDeler); ok {
+		return unavailable(c.SetDel(ctx, key, b, ttl, oldKey))
+	}
+	// set first, so the values are not lost if the delete fails
+	if err := rs.client().Set(ctx, key, b, ttl); err != nil {
+		return unavailable(err)
+	}
+	_, err := rs.client().Del(ctx, oldKey)
+	return unavailable(err)
+}
+
 // load reads the session from redis.
 // returns true if there is a sessoin data in DB
-func (rs *RedisStore) load(session *sessions.Session) (bool, error) {
-	data, err := rs.RedisClient.Get(rs.keyPrefix + session.ID).Result()
+func (rs *RedisStore) load(ctx context.Context, session *sessions.Session) (found bool, err error) {
+	ctx, span := rs.startSpan(ctx, "redisstore.load")
+	ctx, op := rs.measure(ctx, "load")
+	defer func() {
+		spanHit(span, found)
+		endSpan(span, err)
+		op.end(found, err)
+	}()
+	if rs.storage == HashMode {
+		ok, err := rs.loadHash(ctx, session)
+		if err != nil || !ok {
+			return ok, err
+		}
+		return rs.loaded(ctx, session, nil)
+	}
+	data, err := rs.fetch(ctx, rs.key(session.ID))
+	if err == ErrNil {
+		rs.observe().OnLoad(session.ID, false)
+		return false, nil // no data was associated with this key
+	}
+	if err != nil {
+		return false, unavailable(err)
+	}
+	rs.observe().OnLoad(session.ID, true)
+	spanSize(ctx, len(data))
+	return rs.decodeData(ctx, session, data)
+}
+
+// decodeData decodes data read from redis into session, and checks it like
+// load.
+func (rs *RedisStore) decodeData(ctx context.Context, session *sessions.Session, data []byte) (bool, error) {
+	raw := data
+	var err error
+	if rs.versioned() {
+		if data, err = rs.unversion(session, data); err != nil {
+			return true, decodeFailed(err)
+		}
+	}
+	b, err := rs.decode(data)
 	if err != nil {
+		return true, decodeFailed(err)
+	}
+	if err := rs.serializer.Deserialize(b, session); err != nil {
+		return true, deserializeFailed(session.ID, err)
+	}
+	if st := rs.state(session); st != nil {
+		st.loaded = b
+	}
+	return rs.loaded(ctx, session, raw)
+}
+
+// loaded checks the schema version and the absolute max age of a session
+// loaded from raw, nil in HashMode, and refreshes its TTL and last access if
+// RefreshOnGet or an idle timeout is set, unless sessions are read-only for
+// ctx. It reports whether the session is still alive.
+func (rs *RedisStore) loaded(ctx context.Context, session *sessions.Session, raw []byte) (bool, error) {
+	if ok, err := rs.checkSchema(ctx, session); !ok || err != nil {
 		return false, err
 	}
-	return true, rs.serializer.Deserialize([]byte(data), session)
+	if expired, err := rs.expired(ctx, session); expired || err != nil {
+		return false, err
+	}
+	if !rs.RefreshOnGet && rs.idleTimeout <= 0 || rs.readOnlyCtx(ctx) {
+		return true, nil
+	}
+	if rs.metadata {
+		return true, rs.access(ctx, session, raw)
+	}
+	_, err := rs.renew(ctx, session)
+	return true, unavailable(err)
 }
 
 // delete removes keys from redis if MaxAge<0
-func (rs *RedisStore) delete(session *sessions.Session) error {
+func (rs *RedisStore) delete(ctx context.Context, session *sessions.Session) (err error) {
+	ctx, span := rs.startSpan(ctx, "redisstore.delete")
+	_, op := rs.measure(ctx, "delete")
+	defer func() {
+		endSpan(span, err)
+		op.end(false, err)
+	}()
+	_, err = rs.client().Del(ctx, rs.key(session.ID))
+	if err != nil {
+		return unavailable(err)
+	}
+	rs.invalidate(ctx, rs.key(session.ID))
+	rs.observe().OnDelete(session.ID)
+	return nil
+}
 
-	if _, err := rs.RedisClient.Del(rs.keyPrefix + session.ID).Result(); err != nil {
+// ExistsByID reports whether the session with the given ID is stored in
+// redis, without loading it.
+func (rs *RedisStore) ExistsByID(id string) (bool, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return false, err
+	}
+	found, err := rs.client().Exists(context.Background(), rs.key(id))
+	if err != nil {
+		return false, unavailable(err)
+	}
+	return found, nil
+}
+
+// RawGet returns the value stored in redis for the session id as is, e.g.
+// for migration or debugging tools, bypassing deserialization and the local
+// cache. The value is the session as encoded by the store: it starts with
+// the version of the session with SetVersionCheck, and is compressed, with
+// a leading header byte, and encrypted as configured. Only without any of
+// them can the serializer decode it directly. It returns ErrSessionNotFound
+// if the session does not exist. The store must be in BlobMode.
+func (rs *RedisStore) RawGet(ctx context.Context, id string) ([]byte, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	if err := rs.requireMode(BlobMode, "raw access"); err != nil {
+		return nil, err
+	}
+	data, err := rs.client().Get(ctx, rs.key(id))
+	if err == ErrNil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	return data, nil
+}
+
+// LoadByID returns the session with the given ID, for code without the HTTP
+// request carrying its cookie, e.g. background jobs or websocket handlers.
+// The session has no name and can be saved with SaveByID. It returns
+// ErrSessionNotFound if the session does not exist.
+func (rs *RedisStore) LoadByID(id string) (*sessions.Session, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	session := rs.byID(id)
+	found, err := rs.load(context.Background(), session)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+	rs.markLoaded(session)
+	return session, nil
+}
+
+// LoadMany returns the sessions with the given IDs by ID, fetched in a single
+// round trip if the client supports it. Missing sessions are left out of the
+// result, and so are corrupt ones unless the store is strict. Like LoadByID,
+// the sessions have no name and can be saved with SaveByID.
+func (rs *RedisStore) LoadMany(ctx context.Context, ids []string) (loaded map[string]*sessions.Session, err error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	ctx, span := rs.startSpan(ctx, "redisstore.load_many")
+	defer func() { endSpan(span, err) }()
+	return rs.loadMany(ctx, ids)
+}
+
+// loadMany loads the sessions ids, in a single round trip if the client
+// supports it, and returns the ones found by ID.
+func (rs *RedisStore) loadMany(ctx context.Context, ids []string) (loaded map[string]*sessions.Session, err error) {
+	var values [][]byte
+	g, pipelined := rs.client().(pipelinedGetter)
+	pipelined = pipelined && rs.storage != HashMode
+	if pipelined {
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = rs.key(id)
+		}
+		if values, err = g.GetPipelined(ctx, keys...); err != nil {
+			return nil, unavailable(err)
+		}
+	}
+	loaded = make(map[string]*sessions.Session, len(ids))
+	for i, id := range ids {
+		session := rs.byID(id)
+		var found bool
+		switch {
+		case !pipelined:
+			found, err = rs.load(ctx, session)
+		case values[i] == nil:
+			rs.observe().OnLoad(id, false)
+		default:
+			rs.observe().OnLoad(id, true)
+			found, err = rs.decodeData(ctx, session, values[i])
+		}
+		if errors.Is(err, ErrDecodeFailed) {
+			err, found = rs.corrupt(ctx, session, err), false
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			rs.markLoaded(session)
+			loaded[id] = session
+		}
+	}
+	return loaded, nil
+}
+
+// pipelinedGetter is implemented by clients able to send many GET commands
+// in a single round trip.
+type pipelinedGetter interface {
+	// GetPipelined returns the values of keys, with nil for missing keys.
+	// Each key is read with its own GET command, so keys may belong to
+	// different cluster slots.
+	GetPipelined(ctx context.Context, keys ...string) ([][]byte, error)
+}
+
+// byID returns an unnamed session with the given ID and the default options,
+// to be loaded by ID.
+func (rs *RedisStore) byID(id string) *sessions.Session {
+	session := sessions.NewSession(&sessionState{RedisStore: rs}, "")
+	options := *rs.Options
+	session.Options = &options
+	session.ID = id
+	return session
+}
+
+// markLoaded marks session, returned by byID, as found in redis.
+func (rs *RedisStore) markLoaded(session *sessions.Session) {
+	session.IsNew = false
+	st := rs.state(session)
+	st.id, st.options = session.ID, *session.Options
+}
+
+// SaveByID writes session to redis under its ID without setting a cookie,
+// like Save otherwise: sessions with a negative MaxAge are deleted, and a
+// read-only store writes nothing. The session must have an ID and options,
+// e.g. be returned by LoadByID.
+func (rs *RedisStore) SaveByID(session *sessions.Session) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
 		return err
 	}
+	if session.ID == "" || session.Options == nil {
+		return errors.New("redisstore: session has no ID or options")
+	}
+	if rs.readOnly {
+		return nil
+	}
+	return rs.persist(context.Background(), session)
+}
+
+// Delete removes the session with the given ID from redis, e.g. to revoke
+// it server side. It reports whether the session existed; deleting a missing
+// session is not an error.
+func (rs *RedisStore) Delete(id string) (bool, error) {
+	return rs.DeleteWithContext(context.Background(), id)
+}
+
+// DeleteWithContext is like Delete but queries redis with ctx.
+func (rs *RedisStore) DeleteWithContext(ctx context.Context, id string) (found bool, err error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return false, err
+	}
+	if err := rs.writable(ctx); err != nil {
+		return false, err
+	}
+	_, op := rs.measure(ctx, "delete")
+	defer func() { op.end(false, err) }()
+	n, err := rs.client().Del(ctx, rs.key(id))
+	if err != nil {
+		return false, unavailable(err)
+	}
+	rs.invalidate(ctx, rs.key(id))
+	rs.observe().OnDelete(id)
+	return n > 0, nil
+}
+
+// Touch extends the redis TTL of the session to its MaxAge without
+// rewriting its values. It returns ErrSessionNotFound if the session expired.
+func (rs *RedisStore) Touch(session *sessions.Session) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if err := rs.writable(context.Background()); err != nil {
+		return err
+	}
+	found, err := rs.client().Expire(context.Background(), rs.key(session.ID), rs.ttl(session))
+	if err != nil {
+		return unavailable(err)
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
 	return nil
 }
 
 // save stores the session in redis.
-func (rs *RedisStore) save(session *sessions.Session) error {
-	b, err := rs.serializer.Serialize(session)
+// If the store skips unchanged sessions and the values are the same as
+// loaded, only the TTL is refreshed. If create is set, the session is new
+// and save returns errIDTaken instead of overwriting an existing key.
+func (rs *RedisStore) save(ctx context.Context, session *sessions.Session, create bool) (err error) {
+	ctx, span := rs.startSpan(ctx, "redisstore.save")
+	ctx, op := rs.measure(ctx, "save")
+	defer func() {
+		var tooBig *ErrSessionTooBig
+		if errors.As(err, &tooBig) {
+			rs.log(ctx, slog.LevelWarn, "redisstore: session too big", "id", session.ID, "size", tooBig.Size, "limit", tooBig.Limit)
+		}
+		endSpan(span, err)
+		op.end(false, err)
+	}()
+	if rs.storage == HashMode {
+		defer rs.stamp(session)()
+		if create {
+			if err := rs.taken(ctx, rs.key(session.ID)); err != nil {
+				return err
+			}
+		}
+		size, err := rs.saveHash(ctx, session.ID, session)
+		if err == nil {
+			rs.observe().OnSave(session.ID, size)
+			spanSize(ctx, size)
+		}
+		return err
+	}
+	defer rs.stamp(session)()
+	plain, err := rs.serializer.Serialize(session)
+	if err != nil {
+		return serializeFailed(session.ID, err)
+	}
+	st := rs.state(session)
+	if (rs.skipUnchanged || rs.renewal > 0) && st != nil && st.id == session.ID && st.valuesUnchanged(plain, session) {
+		found, err := rs.renew(ctx, session)
+		if err != nil || found {
+			return unavailable(err)
+		}
+		// expired since it was loaded, write it again
+	}
+	b, err := rs.encode(plain)
+	if err != nil {
+		return err
+	}
+	switch {
+	case rs.versioned():
+		err = rs.setVersioned(ctx, session, b)
+		if create && err == ErrSessionConflict {
+			err = errIDTaken // new sessions are written only if the key doesn't exist
+		}
+	case create:
+		err = rs.setNew(ctx, rs.key(session.ID), b, rs.ttl(session))
+	default:
+		err = unavailable(rs.client().Set(ctx, rs.key(session.ID), b, rs.ttl(session)))
+	}
 	if err != nil {
 		return err
 	}
+	rs.invalidate(ctx, rs.key(session.ID))
+	rs.observe().OnSave(session.ID, len(b))
+	spanSize(ctx, len(b))
+	if st != nil {
+		st.loaded = plain
+	}
+	rs.written(session)
+	return nil
+}
+
+// serialize encodes the values of session, stored under id, and checks them
+// against maxLength.
+func (rs *RedisStore) serialize(id string, session *sessions.Session) ([]byte, error) {
+	b, err := rs.serializer.Serialize(session)
+	if err != nil {
+		return nil, serializeFailed(id, err)
+	}
+	return rs.encode(b)
+}
+
+// encode compresses and encrypts serialized values as configured and checks
+// the result against maxLength.
+func (rs *RedisStore) encode(b []byte) ([]byte, error) {
+	var err error
+	switch {
+	case rs.compress && len(b) <= rs.compressMin:
+		b = raw(b)
+	case rs.compress:
+		if b, err = compress(b); err != nil {
+			return nil, err
+		}
+	}
+	if rs.aead != nil {
+		if b, err = encrypt(rs.aead, b); err != nil {
+			return nil, err
+		}
+	}
 	if rs.maxLength != 0 && len(b) > rs.maxLength {
-		return errors.New("SessionStore: the value to store is too big")
+		return nil, &ErrSessionTooBig{Size: len(b), Limit: rs.maxLength}
 	}
+	return b, nil
+}
 
+// decode reverts encode on data read from redis.
+func (rs *RedisStore) decode(data []byte) ([]byte, error) {
+	var err error
+	if rs.aead != nil {
+		if data, err = decrypt(rs.aead, data); err != nil {
+			return nil, err
+		}
+	}
+	if rs.compress {
+		if data, err = decompress(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// ttl returns the redis expiration of the session: MaxAge falling back
+// to DefaultMaxAge, or the idle timeout if set, moved by the TTL jitter,
+// without going past the absolute max age.
+func (rs *RedisStore) ttl(session *sessions.Session) time.Duration {
 	age := session.Options.MaxAge
 	if age == 0 {
 		age = rs.DefaultMaxAge
 	}
-	_, err = rs.RedisClient.Set(rs.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Result()
-	return err
+	var created time.Time
+	if rs.absoluteMaxAge > 0 {
+		created = rs.created(session)
+	}
+	return expiration(age, rs.idleTimeout, rs.absoluteMaxAge, created, rs.now(), rs.jitter())
+}
+
+// expiration returns the redis TTL of a session created at created, with
+// maxAge in seconds, at time now. The idle timeout replaces maxAge if set,
+// and jitter is added without going below minJitteredTTL. The TTL never goes
+// past the absolute max age, but is at least a second as expired sessions
+// are deleted on load.
+func expiration(maxAge int, idle, absolute time.Duration, created, now time.Time, jitter time.Duration) time.Duration {
+	ttl := time.Duration(maxAge) * time.Second
+	if idle > 0 {
+		ttl = idle
+	}
+	if jitter != 0 {
+		floor := ttl
+		if floor > minJitteredTTL {
+			floor = minJitteredTTL
+		}
+		if ttl += jitter; ttl < floor {
+			ttl = floor
+		}
+	}
+	if absolute > 0 {
+		if left := created.Add(absolute).Sub(now); left < ttl {
+			ttl = left
+		}
+		if ttl < time.Second {
+			ttl = time.Second
+		}
+	}
+	return ttl
+}
+
+// Options sets the default cookie options from gin session options. They
+// apply to sessions returned by later calls to New. Like SetMaxAge, it also
+// sets the max age of the signed values; codecs that can't be changed are
+// reported to the logger of the store.
+func (s *Store) Options(op ginsessions.Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setOptions(func(o *sessions.Options) {
+		*o = sessions.Options{
+			Path:     op.Path,
+			Domain:   op.Domain,
+			MaxAge:   op.MaxAge,
+			Secure:   op.Secure,
+			HttpOnly: op.HttpOnly,
+			SameSite: o.SameSite, // not part of ginsessions.Options
+		}
+	})
+	if op.MaxAge >= 0 {
+		if err := s.setCodecsMaxAge(op.MaxAge); err != nil {
+			s.log(context.Background(), slog.LevelWarn, "redisstore: codec max age not changed", "error", err)
+		}
+	}
+}
+
+// setOptions replaces the default cookie options by a copy changed by fn,
+// so that options already handed out are never modified. rs.mu must be
+// locked.
+func (rs *RedisStore) setOptions(fn func(o *sessions.Options)) {
+	o := *rs.Options
+	fn(&o)
+	rs.Options = &o
+}
+
+// SetSameSite sets the SameSite attribute of the session cookie.
+// It is kept when options are changed through the gin adapter.
+func (rs *RedisStore) SetSameSite(v http.SameSite) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.setOptions(func(o *sessions.Options) { o.SameSite = v })
+}
+
+// key returns the redis key of the session id.
+func (rs *RedisStore) key(id string) string {
+	if rs.KeyFunc != nil {
+		return rs.KeyFunc(id)
+	}
+	return rs.keyPrefix + id
+}
+
+// Key returns the redis key session is stored under, e.g. to inspect it with
+// redis-cli, or "" if session has no ID yet.
+func (rs *RedisStore) Key(session *sessions.Session) string {
+	if session.ID == "" {
+		return ""
+	}
+	return rs.KeyForID(session.ID)
 }
-func (rs store) Options(op ginsessions.Options) {
-	rs.RedisStore.Options = &sessions.Options{
-		Path:     op.Path,
-		Domain:   op.Domain,
-		MaxAge:   op.MaxAge,
-		Secure:   op.Secure,
-		HttpOnly: op.HttpOnly,
+
+// KeyForID returns the redis key of the session id, built from the key
+// prefix or KeyFunc like the keys of loaded and saved sessions.
+func (rs *RedisStore) KeyForID(id string) string {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.key(id)
+}
+
+// SetKeyFunc sets KeyFunc, safely while requests are served. It fails while
+// an expiry listener runs, see StartExpiryListener, since the listener only
+// sees keys under the key prefix. Sessions saved under previous keys are no
+// longer found.
+func (rs *RedisStore) SetKeyFunc(fn func(id string) string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if fn != nil && rs.listeners.active() {
+		return errors.New("redisstore: expiry listener requires keys under the key prefix")
 	}
+	rs.KeyFunc = fn
+	return nil
+}
+
+// SetKeyPrefix sets the prefix prepended to session IDs to build redis keys.
+// Sessions saved under a previous prefix are no longer found.
+func (rs *RedisStore) SetKeyPrefix(p string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.keyPrefix = p
+}
+
+// SetMaxLength sets the maximum length of the serialized session stored in
+// redis. 0 disables the check, negative values are ignored.
+func (rs *RedisStore) SetMaxLength(l int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if l >= 0 {
+		rs.maxLength = l
+	}
+}
+
+// SetSerializer sets the serializer used to encode session values in redis.
+func (rs *RedisStore) SetSerializer(ss SessionSerializer) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.serializer = ss
 }
-func (rs *RedisStore) SetMaxAge(v int) {
-	var c *securecookie.SecureCookie
-	var ok bool
-	rs.Options.MaxAge = v
-	for i := range rs.Codecs {
-		if c, ok = rs.Codecs[i].(*securecookie.SecureCookie); ok {
+
+// SetMaxAge sets the max age in seconds of new sessions, of their cookies
+// and of the signed cookie values. Zero makes cookies last for the browser
+// session, with sessions expiring in redis after DefaultMaxAge, and disables
+// the max age of signed values. Negative values are rejected. Codecs other
+// than *securecookie.SecureCookie can't be changed and are reported in the
+// returned error, after the max age is applied to everything else.
+func (rs *RedisStore) SetMaxAge(v int) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if v < 0 {
+		return fmt.Errorf("redisstore: max age must not be negative, got %d", v)
+	}
+	rs.setOptions(func(o *sessions.Options) { o.MaxAge = v })
+	return rs.setCodecsMaxAge(v)
+}
+
+// RotateKeys puts codecs built from newPairs, hash and block keys like those
+// of NewRedisStore, in front of the current ones, so keys can be rotated
+// without logging users out. Cookies are always signed with the first codec,
+// the newest key pair, while decoding tries every codec in order, so cookies
+// signed with retired keys keep working until they are saved again or
+// expire. Build the store without the old pairs once their cookies are gone.
+// The new codecs get the max age of the store.
+func (rs *RedisStore) RotateKeys(newPairs ...[]byte) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	codecs := securecookie.CodecsFromPairs(newPairs...)
+	if age := rs.Options.MaxAge; age >= 0 {
+		for _, codec := range codecs {
+			if c, ok := codec.(*securecookie.SecureCookie); ok {
+				c.MaxAge(age)
+			}
+		}
+	}
+	rs.Codecs = append(codecs, rs.Codecs...)
+}
+
+// setCodecsMaxAge sets the max age of the signed cookie values and returns
+// an error listing the codecs that can't be changed. rs.mu must be locked.
+func (rs *RedisStore) setCodecsMaxAge(v int) error {
+	var unsupported []string
+	for _, codec := range rs.Codecs {
+		if c, ok := codec.(*securecookie.SecureCookie); ok {
 			c.MaxAge(v)
 		} else {
-			fmt.Printf("Can't change MaxAge on codec %v\n", rs.Codecs[i])
+			unsupported = append(unsupported, fmt.Sprintf("%T", codec))
 		}
 	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("redisstore: can't change MaxAge on codecs %s", strings.Join(unsupported, ", "))
+	}
+	return nil
 }
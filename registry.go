@@ -0,0 +1,39 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// statesKey is the request context key of the sessionState of each session
+// name in the request registry.
+type statesKey struct{}
+
+// registered returns the sessionState to pass to the request registry for
+// the session name of r. The registry sets the store of the session to the
+// one it is given, even on a hit, so the same state must be passed each time
+// or Save would lose track of what was loaded.
+func (rs *RedisStore) registered(r *http.Request, name string) *sessionState {
+	states, _ := r.Context().Value(statesKey{}).(map[string]*sessionState)
+	if states == nil {
+		states = make(map[string]*sessionState)
+		// like sessions.GetRegistry, so the states live as long as the registry
+		*r = *r.WithContext(context.WithValue(r.Context(), statesKey{}, states))
+	}
+	st := states[name]
+	if st == nil {
+		st = &sessionState{RedisStore: rs}
+		states[name] = st
+	}
+	return st
+}
+
+// New loads the session name of r into st. It is called by the request
+// registry the first time Get is called for name.
+func (st *sessionState) New(r *http.Request, name string) (*sessions.Session, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.newSession(r.Context(), r, name, st)
+}
@@ -0,0 +1,81 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// countingClient counts the GET and SET commands and the GET pipelines sent
+// to redis.
+type countingClient struct {
+	Client
+	gets, sets, pipelines int
+}
+
+func (c *countingClient) Get(ctx context.Context, key string) ([]byte, error) {
+	c.gets++
+	return c.Client.Get(ctx, key)
+}
+
+func (c *countingClient) GetPipelined(ctx context.Context, keys ...string) ([][]byte, error) {
+	c.pipelines++
+	return c.Client.(pipelinedGetter).GetPipelined(ctx, keys...)
+}
+
+func (c *countingClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.sets++
+	return c.Client.Set(ctx, key, value, ttl)
+}
+
+func TestGetRegistry(t *testing.T) {
+	_, client := newMiniRedis(t)
+	counting := &countingClient{Client: NewGoRedisV9Client(client)}
+	store := NewRedisStoreWithClient(counting, []byte("secret"))
+	store.SetResaveUnchanged(false)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := store.Get(req, sessionName); again != session {
+		t.Error("expected the saved session from the registry")
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	counting.gets, counting.sets = 0, 0
+	var loaded [3]*sessions.Session
+	for i := range loaded {
+		s, err := store.Get(req2, sessionName)
+		if err != nil || s.IsNew || s.Values["key"] != ok {
+			t.Fatalf("expected the saved session, got %v", err)
+		}
+		loaded[i] = s
+	}
+	if counting.gets != 1 {
+		t.Errorf("expected one GET for three accesses, got %d", counting.gets)
+	}
+	if loaded[1] != loaded[0] || loaded[2] != loaded[0] {
+		t.Error("expected every access to return the same session")
+	}
+
+	// the registry keeps what was loaded, so unchanged sessions aren't rewritten
+	if err := sessions.Save(req2, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	if counting.sets != 0 {
+		t.Errorf("expected no SET for an unchanged session, got %d", counting.sets)
+	}
+
+	if s, _ := store.New(req2, sessionName); s == loaded[0] || counting.gets != 2 {
+		t.Errorf("expected New to load the session again, got %d GETs", counting.gets)
+	}
+}
@@ -0,0 +1,500 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Number of keys asked for by each SCAN call.
+const scanCount = 100
+
+// scanClient is implemented by clients able to iterate over keys.
+type scanClient interface {
+	// Scan calls fn with batches of the keys matching the glob pattern
+	// match, on every node. Keys may be seen more than once.
+	Scan(ctx context.Context, match string, fn func(keys []string) error) error
+}
+
+// pageScanner is implemented by clients able to return pages of keys.
+type pageScanner interface {
+	// ScanPage returns a page of about count keys matching the glob pattern
+	// match from cursor, and the cursor of the next page, 0 after the last
+	// one. It returns errClusterScan for cluster clients, whose nodes have
+	// cursors of their own.
+	ScanPage(ctx context.Context, cursor uint64, match string, count int64) (keys []string, next uint64, err error)
+}
+
+// errClusterScan is returned by ScanPage for cluster clients.
+var errClusterScan = errors.New("redisstore: cannot page through the keys of a cluster, use ForEachSession")
+
+// errKeyFunc is returned by the methods turning scanned keys into session
+// IDs for stores with a KeyFunc, which can't be reversed.
+var errKeyFunc = errors.New("redisstore: cannot read session IDs from keys built by a KeyFunc")
+
+// ListSessionIDs returns the IDs of the sessions stored under the key prefix.
+// It uses SCAN, so sessions created or deleted in the meantime may or may
+// not be listed. With an empty key prefix, every key of the database that is
+// not a user index, a tag set or a session lock is listed.
+func (rs *RedisStore) ListSessionIDs(ctx context.Context) ([]string, error) {
+	sc, err := rs.scanner(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	err = sc.sessions(ctx, func(keys []string) error {
+		for _, key := range keys {
+			id := strings.TrimPrefix(key, sc.prefix)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Count returns the number of sessions stored under the key prefix. It uses
+// SCAN, which doesn't block redis, without keeping the IDs in memory, so the
+// count is approximate while sessions are created or expire: they may be
+// missed or counted twice. With an empty key prefix, every key of the
+// database is counted as a session, except the user indexes, tag sets,
+// locks and health checks of the store.
+func (rs *RedisStore) Count(ctx context.Context) (int64, error) {
+	sc, err := rs.scanner(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = sc.sessions(ctx, func(keys []string) error {
+		n += int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Scan returns a page of the IDs of the sessions stored under the key prefix,
+// starting from cursor, 0 for the first page, and the cursor of the next
+// page, 0 after the last one, e.g. to page through the sessions in an admin
+// UI. count is a hint of the number of keys read per page, and user indexes,
+// tag sets and locks are left out, so pages may be shorter, even empty,
+// before the last one. Like any SCAN, it is approximate under load: sessions
+// created or deleted meanwhile may be missed, and IDs may be returned more
+// than once. Clusters can't be paged through; use ForEachSession.
+func (rs *RedisStore) Scan(ctx context.Context, cursor uint64, count int64) (ids []string, next uint64, err error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, 0, err
+	}
+	if rs.KeyFunc != nil {
+		return nil, 0, errKeyFunc
+	}
+	s, ok := rs.client().(pageScanner)
+	if !ok {
+		return nil, 0, errors.New("redisstore: client does not support scanning keys")
+	}
+	if count <= 0 {
+		count = scanCount
+	}
+	keys, next, err := s.ScanPage(ctx, cursor, globEscape(rs.keyPrefix)+"*", count)
+	if errors.Is(err, errClusterScan) {
+		return nil, 0, err
+	}
+	if err != nil {
+		return nil, 0, unavailable(err)
+	}
+	for _, key := range keys {
+		if !auxiliary(rs.keyPrefix, key) {
+			ids = append(ids, strings.TrimPrefix(key, rs.keyPrefix))
+		}
+	}
+	return ids, next, nil
+}
+
+// ForEachSession calls fn with each session stored under the key prefix,
+// loaded by ID like LoadMany, e.g. for audits. Sessions are scanned and
+// loaded in batches, so it is approximate under load like ListSessionIDs,
+// and sessions deleted meanwhile are skipped. It stops at the first error of
+// fn and returns it. The settings of the store are read once; fn is called
+// without holding them, so it may load, save or delete sessions.
+func (rs *RedisStore) ForEachSession(ctx context.Context, fn func(id string, s *sessions.Session) error) error {
+	sc, err := rs.scanner(ctx, true)
+	if err != nil {
+		return err
+	}
+	return sc.forEachSession(ctx, fn)
+}
+
+// forEachSession calls fn with each session stored under the key prefix, and
+// returns the first error of fn as is.
+func (sc *scanner) forEachSession(ctx context.Context, fn func(id string, s *sessions.Session) error) error {
+	seen := make(map[string]bool)
+	var fnErr error
+	err := sc.sessions(ctx, func(keys []string) error {
+		var ids []string
+		for _, key := range keys {
+			id := strings.TrimPrefix(key, sc.prefix)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		var loaded map[string]*sessions.Session
+		err := sc.rs.locked(func() (err error) {
+			loaded, err = sc.rs.loadMany(ctx, ids)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if s, ok := loaded[id]; ok {
+				if fnErr = fn(id, s); fnErr != nil {
+					return fnErr
+				}
+			}
+		}
+		return nil
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// Flush deletes every key under the key prefix: all sessions and user
+// indexes. Keys are deleted in pipelined batches as they are scanned.
+// With an empty key prefix, this deletes every key of the database.
+func (rs *RedisStore) Flush(ctx context.Context) error {
+	sc, err := rs.scanner(ctx, false)
+	if err == nil {
+		err = sc.writable()
+	}
+	if err != nil {
+		return err
+	}
+	err = sc.scan(ctx, func(keys []string) error {
+		return rs.locked(func() error {
+			_, err := rs.del(ctx, keys)
+			return err
+		})
+	})
+	rs.locked(func() error {
+		rs.invalidate(ctx)
+		return nil
+	})
+	return err
+}
+
+// SetDeleteBatchSize sets the number of keys DeleteAll and DeleteWhere
+// delete per round trip, each with its own DEL command so redis is never
+// blocked by a huge one, 100 by default. Zero or less restores the default.
+func (rs *RedisStore) SetDeleteBatchSize(n int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if n <= 0 {
+		n = scanCount
+	}
+	rs.deleteBatch = n
+}
+
+// DeleteAll deletes every session under the key prefix, e.g. to log everyone
+// out after rotating the keys of the store, without touching the other keys
+// of a shared database, and returns the number of sessions deleted. Sessions
+// are scanned and deleted in batches, see SetDeleteBatchSize, so sessions
+// created meanwhile may be kept. User indexes, tag sets and locks are left
+// to expire; Flush deletes them too.
+func (rs *RedisStore) DeleteAll(ctx context.Context) (int64, error) {
+	sc, err := rs.scanner(ctx, true)
+	if err == nil {
+		err = sc.writable()
+	}
+	if err != nil {
+		return 0, err
+	}
+	d := sc.deleter(ctx)
+	err = sc.sessions(ctx, func(keys []string) error {
+		for _, key := range keys {
+			if err := d.add(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return d.n, err
+	}
+	return d.n, unavailable(d.flush())
+}
+
+// DeleteWhere deletes the sessions under the key prefix for which pred
+// returns true, e.g. every session whose "role" value is "admin", and returns
+// the number of sessions deleted. Sessions are loaded like ForEachSession,
+// and pred is called the same way, and deleted in batches like DeleteAll.
+func (rs *RedisStore) DeleteWhere(ctx context.Context, pred func(id string, s *sessions.Session) bool) (int64, error) {
+	sc, err := rs.scanner(ctx, true)
+	if err == nil {
+		err = sc.writable()
+	}
+	if err != nil {
+		return 0, err
+	}
+	d := sc.deleter(ctx)
+	err = sc.forEachSession(ctx, func(id string, s *sessions.Session) error {
+		if !pred(id, s) {
+			return nil
+		}
+		return unavailable(d.add(sc.prefix + id)) // no KeyFunc, see scanner
+	})
+	if err != nil {
+		return d.n, err
+	}
+	return d.n, unavailable(d.flush())
+}
+
+// batchDeleter deletes keys in batches, dropping them from the local cache
+// and reporting them to the observer.
+type batchDeleter struct {
+	sc   *scanner
+	ctx  context.Context
+	keys []string
+	n    int64 // keys deleted so far
+}
+
+// deleter returns a batchDeleter with the batch size of the store.
+func (sc *scanner) deleter(ctx context.Context) *batchDeleter {
+	return &batchDeleter{sc: sc, ctx: ctx}
+}
+
+// add deletes key with the batch it completes.
+func (d *batchDeleter) add(key string) error {
+	d.keys = append(d.keys, key)
+	if len(d.keys) < d.sc.deleteBatch {
+		return nil
+	}
+	return d.flush()
+}
+
+// flush deletes the pending keys.
+func (d *batchDeleter) flush() error {
+	keys := d.keys
+	d.keys = nil
+	rs := d.sc.rs
+	return rs.locked(func() error {
+		n, err := rs.del(d.ctx, keys)
+		d.n += n
+		if err != nil {
+			return err
+		}
+		rs.invalidate(d.ctx, keys...)
+		for _, key := range keys {
+			rs.observe().OnDelete(strings.TrimPrefix(key, d.sc.prefix))
+		}
+		return nil
+	})
+}
+
+// DeleteExpired deletes the sessions under the key prefix expiring in redis
+// within olderThan, e.g. from a periodic job cleaning up sessions about to
+// expire, whose cookies may linger long after. Sessions that don't expire are
+// kept. Keys are scanned, their TTLs read and deleted in batches, with one
+// command per key, so keys may live on different cluster nodes. It returns
+// the number of sessions deleted.
+func (rs *RedisStore) DeleteExpired(ctx context.Context, olderThan time.Duration) (int, error) {
+	sc, err := rs.scanner(ctx, true)
+	if err == nil {
+		err = sc.writable()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := sc.client.(ttlClient); !ok {
+		return 0, errors.New("redisstore: client does not support reading TTLs")
+	}
+	n := 0
+	err = sc.sessions(ctx, func(keys []string) error {
+		return rs.locked(func() error {
+			ttls, err := rs.ttls(ctx, keys)
+			if err != nil {
+				return err
+			}
+			var expiring []string
+			for i, ttl := range ttls {
+				if ttl >= 0 && ttl < olderThan { // negative if gone or not expiring
+					expiring = append(expiring, keys[i])
+				}
+			}
+			deleted, err := rs.del(ctx, expiring)
+			if err != nil {
+				return err
+			}
+			rs.invalidate(ctx, expiring...)
+			for _, key := range expiring {
+				rs.observe().OnDelete(strings.TrimPrefix(key, sc.prefix))
+			}
+			n += int(deleted) // keys may be gone since their TTL was read
+			return nil
+		})
+	})
+	return n, err
+}
+
+// ttls returns the TTLs of keys, in a single round trip if the client
+// supports it.
+func (rs *RedisStore) ttls(ctx context.Context, keys []string) ([]time.Duration, error) {
+	if p, ok := rs.client().(pipelinedTTLer); ok {
+		return p.TTLPipelined(ctx, keys...)
+	}
+	ttls := make([]time.Duration, len(keys))
+	for i, key := range keys {
+		ttl, err := rs.client().(ttlClient).TTL(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		ttls[i] = ttl
+	}
+	return ttls, nil
+}
+
+// pipelinedTTLer is implemented by clients able to read many TTLs in a
+// single round trip.
+type pipelinedTTLer interface {
+	// TTLPipelined returns the TTL of each of keys like TTL.
+	TTLPipelined(ctx context.Context, keys ...string) ([]time.Duration, error)
+}
+
+// del deletes keys in a single round trip if the client supports it, with
+// one command per key, and returns the number of keys deleted.
+func (rs *RedisStore) del(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if d, ok := rs.client().(pipelinedDeleter); ok {
+		return d.DelPipelined(ctx, keys...)
+	}
+	var n int64
+	for _, key := range keys {
+		deleted, err := rs.client().Del(ctx, key)
+		if err != nil {
+			return n, err
+		}
+		n += deleted
+	}
+	return n, nil
+}
+
+// pipelinedDeleter is implemented by clients able to send many DEL commands
+// in a single round trip.
+type pipelinedDeleter interface {
+	// DelPipelined deletes each of keys with its own DEL command, so keys
+	// may belong to different cluster slots, and returns the number of keys
+	// deleted.
+	DelPipelined(ctx context.Context, keys ...string) (int64, error)
+}
+
+// auxiliary reports whether key, under prefix, is kept by the store next to
+// the sessions: user indexes, tag sets, locks and health check probes.
+func auxiliary(prefix, key string) bool {
+	return strings.HasPrefix(key, prefix+"user:") || strings.HasPrefix(key, prefix+"tag:") ||
+		strings.HasPrefix(key, prefix+healthPrefix) || strings.HasSuffix(key, lockSuffix)
+}
+
+// scanner scans the keys under the key prefix with the settings of the store
+// read once, so the lock of the store isn't held for the whole scan, which
+// would block the setters, and the requests waiting behind them, meanwhile.
+// Batches of keys take the lock again to use the store, see locked, and the
+// callbacks of the caller run without it.
+type scanner struct {
+	rs          *RedisStore
+	client      Client
+	prefix      string
+	deleteBatch int
+	readOnly    bool
+}
+
+// scanner returns a scanner of the keys under the key prefix. With ids set,
+// it fails for stores with a KeyFunc, whose keys can't be turned back into
+// session IDs.
+func (rs *RedisStore) scanner(ctx context.Context, ids bool) (*scanner, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	if ids && rs.KeyFunc != nil {
+		return nil, errKeyFunc
+	}
+	if _, ok := rs.client().(scanClient); !ok {
+		return nil, errors.New("redisstore: client does not support scanning keys")
+	}
+	size := rs.deleteBatch
+	if size <= 0 {
+		size = scanCount
+	}
+	return &scanner{rs: rs, client: rs.client(), prefix: rs.keyPrefix, deleteBatch: size, readOnly: rs.readOnlyCtx(ctx)}, nil
+}
+
+// writable returns ErrReadOnly if sessions are read-only for the scan.
+func (sc *scanner) writable() error {
+	if sc.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// scan calls fn with batches of the keys under the key prefix.
+func (sc *scanner) scan(ctx context.Context, fn func(keys []string) error) error {
+	return unavailable(sc.client.(scanClient).Scan(ctx, globEscape(sc.prefix)+"*", fn))
+}
+
+// sessions calls fn with batches of session keys.
+func (sc *scanner) sessions(ctx context.Context, fn func(keys []string) error) error {
+	return sc.scan(ctx, func(keys []string) error {
+		sessions := keys[:0]
+		for _, key := range keys {
+			if !auxiliary(sc.prefix, key) {
+				sessions = append(sessions, key)
+			}
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+		return fn(sessions)
+	})
+}
+
+// locked calls fn holding the read lock of the store, unless the store was
+// closed.
+func (rs *RedisStore) locked(fn func() error) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// globEscape escapes the special characters of redis glob patterns in s.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', '*', '?', '[', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
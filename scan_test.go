@@ -0,0 +1,427 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestListSessionIDs(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("other:key", "value")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetUserIDKey(DefaultUserIDKey)
+			store.SetKeyPrefix("session*:")
+
+			var ids []string
+			for i := 0; i < 250; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				store.BindUser(session, "alice")
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, session.ID)
+			}
+			mr.Set("session:unrelated", "value")
+
+			found, err := store.ListSessionIDs(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(ids)
+			sort.Strings(found)
+			if strings.Join(found, ",") != strings.Join(ids, ",") {
+				t.Errorf("expected %d session IDs, got %d: %v", len(ids), len(found), found)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("other:key", "value")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetUserIDKey(DefaultUserIDKey)
+			store.SetKeyPrefix("session:")
+
+			const n = 150
+			for i := 0; i < n; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				store.BindUser(session, "alice")
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			count, err := store.Count(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != n {
+				t.Errorf("expected %d sessions, got %d", n, count)
+			}
+		})
+	}
+}
+
+func TestCountEmptyPrefix(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	mr.Set("other:key", "value")
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetUserIDKey(DefaultUserIDKey)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		store.BindUser(session, "alice")
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := store.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected the sessions and the other key to be counted, got %d", count)
+	}
+}
+
+// pagingClient is a go-redis client returning keys in pages of the asked
+// size, which miniredis doesn't do.
+type pagingClient struct {
+	goRedisV9
+}
+
+func (c pagingClient) ScanPage(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error) {
+	keys, _, err := c.goRedisV9.ScanPage(ctx, 0, match, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(keys)
+	keys = keys[cursor:]
+	if int64(len(keys)) <= count {
+		return keys, 0, nil
+	}
+	return keys[:count], cursor + uint64(count), nil
+}
+
+func (c pagingClient) Scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	for cursor := uint64(0); ; {
+		keys, next, err := c.ScanPage(ctx, cursor, match, scanCount)
+		if err != nil {
+			return err
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func TestScan(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	all := clients(t, mr)
+	all["paged"] = pagingClient{all["go-redis/v9"].(goRedisV9)}
+	for name, c := range all {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("other:key", "value")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetUserIDKey(DefaultUserIDKey)
+			store.SetKeyPrefix("session:")
+
+			var ids []string
+			for i := 0; i < 25; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				session.Values["n"] = i
+				store.BindUser(session, "alice")
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, session.ID)
+			}
+
+			var found []string
+			pages := 0
+			for cursor := uint64(0); ; {
+				pages++
+				page, next, err := store.Scan(context.Background(), cursor, 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				found = append(found, page...)
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+			if _, paged := c.(pagingClient); paged && pages < 3 {
+				t.Errorf("expected several pages, got %d", pages)
+			}
+			sort.Strings(ids)
+			sort.Strings(found)
+			if strings.Join(found, ",") != strings.Join(ids, ",") {
+				t.Errorf("expected %d session IDs, got %d: %v", len(ids), len(found), found)
+			}
+
+			loaded := map[string]int{}
+			err := store.ForEachSession(context.Background(), func(id string, s *sessions.Session) error {
+				loaded[id], _ = s.Values["n"].(int)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded) != len(ids) {
+				t.Errorf("expected %d sessions, got %d", len(ids), len(loaded))
+			}
+			stop := errors.New("stop")
+			calls := 0
+			err = store.ForEachSession(context.Background(), func(string, *sessions.Session) error {
+				calls++
+				return stop
+			})
+			if err != stop || calls != 1 {
+				t.Errorf("expected the error of fn after a call, got %v after %d", err, calls)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("other:key", "value")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetUserIDKey(DefaultUserIDKey)
+			store.SetKeyPrefix("session:")
+
+			var cookies []string
+			for i := 0; i < 250; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				store.BindUser(session, "alice")
+				res := httptest.NewRecorder()
+				if err := store.Save(req, res, session); err != nil {
+					t.Fatal(err)
+				}
+				cookies = append(cookies, res.Header().Get("Set-Cookie"))
+			}
+
+			if err := store.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			for _, cookie := range cookies {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.Header.Set("Cookie", cookie)
+				if s, _ := store.Get(req, sessionName); !s.IsNew {
+					t.Fatal("expected flushed session to be gone")
+				}
+			}
+			if keys := mr.Keys(); len(keys) != 1 || keys[0] != "other:key" {
+				t.Errorf("expected only keys outside the prefix to remain, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			mr.Set("other:key", "value")
+			mr.Set("sessions", "value")
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetKeyPrefix("session:")
+			store.SetDeleteBatchSize(7)
+			var admins []string
+			for i := 0; i < 25; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				if i%5 == 0 {
+					session.Values["role"] = "admin"
+				}
+				if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+					t.Fatal(err)
+				}
+				if i%5 == 0 {
+					admins = append(admins, session.ID)
+				}
+			}
+			o := &recordingObserver{}
+			store.SetObserver(o)
+
+			n, err := store.DeleteWhere(context.Background(), func(id string, s *sessions.Session) bool {
+				return s.Values["role"] == "admin"
+			})
+			if err != nil || n != 5 {
+				t.Fatalf("expected the 5 admin sessions to be deleted, got %d, %v", n, err)
+			}
+			for _, id := range admins {
+				if !strings.Contains(strings.Join(o.events, ","), "delete "+id) {
+					t.Errorf("expected the deletion of %s to be observed", id)
+				}
+			}
+			for _, id := range admins {
+				if mr.Exists("session:" + id) {
+					t.Errorf("expected admin session %s to be deleted", id)
+				}
+			}
+			if count, _ := store.Count(context.Background()); count != 20 {
+				t.Errorf("expected the other sessions to be kept, got %d", count)
+			}
+
+			if n, err := store.DeleteAll(context.Background()); err != nil || n != 20 {
+				t.Fatalf("expected the 20 remaining sessions to be deleted, got %d, %v", n, err)
+			}
+			if keys := mr.Keys(); len(keys) != 2 || keys[0] != "other:key" || keys[1] != "sessions" {
+				t.Errorf("expected only keys outside the prefix to remain, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			for i := 0; i < 250; i++ {
+				short, long := fmt.Sprintf("session:short%d", i), fmt.Sprintf("session:long%d", i)
+				mr.Set(short, "v")
+				mr.SetTTL(short, 10*time.Second)
+				mr.Set(long, "v")
+				mr.SetTTL(long, time.Hour)
+			}
+			mr.Set("session:forever", "v")
+			mr.Set("other:key", "v")
+			mr.SetTTL("other:key", time.Second)
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetKeyPrefix("session:")
+
+			n, err := store.DeleteExpired(context.Background(), time.Minute)
+			if err != nil || n != 250 {
+				t.Fatalf("expected 250 sessions deleted, got %d, %v", n, err)
+			}
+			for _, key := range mr.Keys() {
+				if strings.HasPrefix(key, "session:short") {
+					t.Fatalf("expected %s to be deleted", key)
+				}
+			}
+			if len(mr.Keys()) != 252 || !mr.Exists("session:forever") || !mr.Exists("other:key") {
+				t.Errorf("expected the other keys to remain, got %d keys", len(mr.Keys()))
+			}
+		})
+	}
+}
+
+// vanishingClient calls vanish once TTLs are read, e.g. to expire a key
+// before DeleteExpired deletes it.
+type vanishingClient struct {
+	goRedisV9
+	vanish func()
+}
+
+func (c vanishingClient) TTLPipelined(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	ttls, err := c.goRedisV9.TTLPipelined(ctx, keys...)
+	c.vanish()
+	return ttls, err
+}
+
+func TestDeleteExpiredVanished(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	for _, key := range []string{"session:a", "session:b"} {
+		mr.Set(key, "v")
+		mr.SetTTL(key, 10*time.Second)
+	}
+	store := NewRedisStoreWithClient(vanishingClient{goRedisV9{client}, func() { mr.Del("session:a") }}, []byte("secret"))
+	store.SetKeyPrefix("session:")
+	if n, err := store.DeleteExpired(context.Background(), time.Minute); err != nil || n != 1 {
+		t.Errorf("expected only the session still there to be counted, got %d, %v", n, err)
+	}
+}
+
+func TestScanKeyFunc(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetKeyPrefix("session:")
+	if err := store.SetKeyFunc(func(id string) string { return "session:{app}:" + id }); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids, err := store.ListSessionIDs(context.Background()); !errors.Is(err, errKeyFunc) {
+		t.Errorf("expected ListSessionIDs to fail with a KeyFunc, got %v, %v", ids, err)
+	}
+	n, err := store.DeleteWhere(context.Background(), func(string, *sessions.Session) bool { return true })
+	if !errors.Is(err, errKeyFunc) || n != 0 {
+		t.Errorf("expected DeleteWhere to fail with a KeyFunc, got %d, %v", n, err)
+	}
+	if !mr.Exists("session:{app}:" + session.ID) {
+		t.Error("expected the session to be kept")
+	}
+}
+
+func TestDeleteWhereUnlocked(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		session.Values["key"] = ok
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.DeleteWhere(context.Background(), func(id string, s *sessions.Session) bool {
+			store.SetMaxLength(8192) // waits for the requests in flight
+			loaded, err := store.LoadByID(id)
+			if err != nil || loaded.Values["key"] != ok {
+				t.Errorf("expected the session to load from pred, got %v", err)
+			}
+			return true
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected pred to run without the lock of the store")
+	}
+	if n, _ := store.Count(context.Background()); n != 0 {
+		t.Errorf("expected the sessions to be deleted, got %d", n)
+	}
+}
@@ -0,0 +1,60 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/gorilla/sessions"
+)
+
+// schemaKey is the session value recording the SchemaVersion a session was
+// saved with, kept in redis when SchemaVersion is set. It is removed from
+// the values returned by New.
+const schemaKey = "redisstore.schema"
+
+// schemaVersion takes the schema version out of the values of a loaded
+// session. Sessions saved without one have version zero.
+func schemaVersion(session *sessions.Session) int {
+	v := reflect.ValueOf(session.Values[schemaKey])
+	delete(session.Values, schemaKey)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64: // JSON
+		return int(v.Float())
+	}
+	return 0
+}
+
+// checkSchema checks the schema version of a loaded session against
+// SchemaVersion and reports whether the session can be used. Sessions saved
+// by a newer schema are left in redis for the code that wrote them, and
+// sessions older than MinSchemaVersion are deleted, unless the request is
+// read-only; both are reset. Other older sessions are passed to
+// MigrateSession.
+func (rs *RedisStore) checkSchema(ctx context.Context, session *sessions.Session) (bool, error) {
+	version := schemaVersion(session)
+	switch {
+	case rs.SchemaVersion <= 0 || version == rs.SchemaVersion:
+		return true, nil
+	case version > rs.SchemaVersion:
+		rs.log(ctx, slog.LevelWarn, "redisstore: ignoring session of a newer schema", "id", session.ID, "version", version)
+		session.Values = make(map[interface{}]interface{})
+		return false, nil
+	case version < rs.MinSchemaVersion:
+		session.Values = make(map[interface{}]interface{})
+		if rs.readOnlyCtx(ctx) {
+			return false, nil
+		}
+		return false, rs.delete(ctx, session)
+	case rs.MigrateSession != nil:
+		if err := rs.MigrateSession(session, version); err != nil {
+			return false, fmt.Errorf("redisstore: migrate session %q from schema %d: %w", session.ID, version, err)
+		}
+	}
+	return true, nil
+}
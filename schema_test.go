@@ -0,0 +1,106 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// saveWithSchema saves a session with the value key set to v by a store at
+// schema version, and returns its cookie and ID.
+func saveWithSchema(t *testing.T, client *redis.Client, version int, v string) (string, string) {
+	store := NewRedisStore(client, []byte("secret"))
+	store.SchemaVersion = version
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = v
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	return res.Header().Get("Set-Cookie"), session.ID
+}
+
+func loadCookie(t *testing.T, store *Store, cookie string) *sessions.Session {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", cookie)
+	session, err := store.Get(req, sessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestSchemaVersion(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SchemaVersion = 2
+	store.MinSchemaVersion = 1
+	var migrated []int
+	store.MigrateSession = func(session *sessions.Session, version int) error {
+		migrated = append(migrated, version)
+		session.Values["key"] = session.Values["key"].(string) + " migrated"
+		return nil
+	}
+
+	cookie, _ := saveWithSchema(t, client, 2, "current")
+	if s := loadCookie(t, store, cookie); s.IsNew || s.Values["key"] != "current" || len(s.Values) != 1 {
+		t.Errorf("expected the current session without its version, got %v", s.Values)
+	}
+
+	cookie, id := saveWithSchema(t, client, 3, "newer")
+	if s := loadCookie(t, store, cookie); !s.IsNew || len(s.Values) != 0 || s.ID == id {
+		t.Errorf("expected a new session instead of the newer one, got %v", s.Values)
+	}
+	if !mr.Exists(id) {
+		t.Error("expected the newer session to be left in redis")
+	}
+
+	cookie, id = saveWithSchema(t, client, 0, "stale")
+	if s := loadCookie(t, store, cookie); !s.IsNew || len(s.Values) != 0 {
+		t.Errorf("expected a new session instead of the stale one, got %v", s.Values)
+	}
+	if mr.Exists(id) {
+		t.Error("expected the stale session to be deleted")
+	}
+
+	cookie, _ = saveWithSchema(t, client, 1, "old")
+	s := loadCookie(t, store, cookie)
+	if len(migrated) != 1 || migrated[0] != 1 || s.Values["key"] != "old migrated" {
+		t.Fatalf("expected the old session to be migrated, got %v and %v", migrated, s.Values)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	if s := loadCookie(t, store, cookie); len(migrated) != 1 || s.Values["key"] != "old migrated" {
+		t.Errorf("expected the migrated session to be saved with the current version, got %v", migrated)
+	}
+}
+
+func TestSchemaVersionJSON(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetSerializer(JSONSerializer{})
+	store.SchemaVersion = 1
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	store.SchemaVersion = 0
+	if s := loadCookie(t, store, res.Header().Get("Set-Cookie")); s.Values[schemaKey] != nil {
+		t.Errorf("expected the version in redis to be hidden, got %v", s.Values)
+	}
+	store.SchemaVersion = 1
+	store.MinSchemaVersion = 1
+	if s := loadCookie(t, store, res.Header().Get("Set-Cookie")); s.IsNew {
+		t.Error("expected the JSON version to be read")
+	}
+}
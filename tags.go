@@ -0,0 +1,159 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// tagsKey is the session value holding the tags of a session.
+const tagsKey = "redisstore.tags"
+
+// Script adding a member to a set and extending the TTL of the set to at
+// least ARGV[2] milliseconds.
+const saddScript = `redis.call("SADD", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1`
+
+// tagClient is implemented by clients supporting tags, sets of the IDs of
+// the sessions tagged with them.
+type tagClient interface {
+	// SAdd adds member to the set key and extends the TTL of key to at
+	// least ttl.
+	SAdd(ctx context.Context, key, member string, ttl time.Duration) error
+	// SRem removes members from the set key.
+	SRem(ctx context.Context, key string, members ...string) error
+	// SMembers returns the members of the set key.
+	SMembers(ctx context.Context, key string) ([]string, error)
+}
+
+// Tag adds tags to session, e.g. the ID of its user or tenant, so all the
+// sessions with a tag can be deleted at once with InvalidateTag. The tags
+// are kept in the session values and their sets updated by the next Save.
+func (rs *RedisStore) Tag(session *sessions.Session, tags ...string) {
+	current := rs.Tags(session)
+	for _, tag := range tags {
+		if !contains(current, tag) {
+			current = append(current, tag)
+		}
+	}
+	session.Values[tagsKey] = current
+}
+
+// Tags returns the tags of session.
+func (rs *RedisStore) Tags(session *sessions.Session) []string {
+	switch v := session.Values[tagsKey].(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []interface{}: // JSON and MessagePack
+		tags := make([]string, 0, len(v))
+		for _, tag := range v {
+			if s, ok := tag.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// InvalidateTag deletes every session tagged with tag, and the set of the
+// tag, without scanning the keys of the store. Sessions deleted by ID stay
+// in the sets of their tags until then, which is harmless.
+func (rs *RedisStore) InvalidateTag(ctx context.Context, tag string) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	if err := rs.writable(ctx); err != nil {
+		return err
+	}
+	s, err := rs.tagSets()
+	if err != nil {
+		return err
+	}
+	ids, err := s.SMembers(ctx, rs.tagSet(tag))
+	if err != nil {
+		return unavailable(err)
+	}
+	// one key at a time, keys of a cluster may live on different nodes
+	for _, id := range ids {
+		n, err := rs.client().Del(ctx, rs.key(id))
+		if err != nil {
+			return unavailable(err)
+		}
+		rs.invalidate(ctx, rs.key(id))
+		if n > 0 {
+			rs.observe().OnDelete(id)
+		}
+	}
+	_, err = rs.client().Del(ctx, rs.tagSet(tag))
+	return unavailable(err)
+}
+
+// tagSets returns the client of the store as a tagClient.
+func (rs *RedisStore) tagSets() (tagClient, error) {
+	s, ok := rs.client().(tagClient)
+	if !ok {
+		return nil, errors.New("redisstore: client does not support tags")
+	}
+	return s, nil
+}
+
+// tagSet returns the key of the set of session IDs tagged with tag, built
+// like session keys so that a KeyFunc applies to it too, see userIndex.
+func (rs *RedisStore) tagSet(tag string) string {
+	return rs.key("tag:" + tag)
+}
+
+// tag adds the saved session to the sets of its tags.
+func (rs *RedisStore) tag(ctx context.Context, session *sessions.Session) error {
+	tags := rs.Tags(session)
+	if len(tags) == 0 {
+		return nil
+	}
+	s, err := rs.tagSets()
+	if err != nil {
+		return err
+	}
+	ttl := rs.ttl(session)
+	for _, tag := range tags {
+		if err := s.SAdd(ctx, rs.tagSet(tag), session.ID, ttl); err != nil {
+			return unavailable(err)
+		}
+	}
+	return nil
+}
+
+// untag removes the session id from the sets of the tags of session.
+func (rs *RedisStore) untag(ctx context.Context, session *sessions.Session, id string) error {
+	tags := rs.Tags(session)
+	if len(tags) == 0 {
+		return nil
+	}
+	s, err := rs.tagSets()
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := s.SRem(ctx, rs.tagSet(tag), id); err != nil {
+			return unavailable(err)
+		}
+	}
+	return nil
+}
+
+// contains reports whether values holds value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
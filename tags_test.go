@@ -0,0 +1,94 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetKeyPrefix(name + ":")
+			ctx := context.Background()
+			save := func(tags ...string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.New(req, sessionName)
+				session.Values["key"] = ok
+				store.Tag(session, tags...)
+				res := httptest.NewRecorder()
+				if err := store.Save(req, res, session); err != nil {
+					t.Fatal(err)
+				}
+				return res
+			}
+			phone, laptop := save("user:42"), save("user:42", "tenant:a")
+			other := save("user:7")
+
+			if members, _ := mr.Members(name + ":tag:user:42"); len(members) != 2 {
+				t.Fatalf("expected both sessions of the user in the tag set, got %v", members)
+			}
+			if mr.TTL(name+":tag:user:42") <= 0 {
+				t.Error("expected the tag set to expire")
+			}
+			if ids, err := store.ListSessionIDs(ctx); err != nil || len(ids) != 3 {
+				t.Errorf("expected tag sets not to be listed, got %v, %v", ids, err)
+			}
+			s, _ := store.New(requestWith(laptop), sessionName)
+			if tags := store.Tags(s); len(tags) != 2 || tags[0] != "user:42" || tags[1] != "tenant:a" {
+				t.Errorf("expected the tags to be loaded, got %v", tags)
+			}
+
+			if err := store.InvalidateTag(ctx, "user:42"); err != nil {
+				t.Fatal(err)
+			}
+			for _, res := range []*httptest.ResponseRecorder{phone, laptop} {
+				if s, _ := store.New(requestWith(res), sessionName); !s.IsNew {
+					t.Error("expected the tagged session to be deleted")
+				}
+			}
+			if mr.Exists(name + ":tag:user:42") {
+				t.Error("expected the tag set to be deleted")
+			}
+			if s, _ := store.New(requestWith(other), sessionName); s.IsNew {
+				t.Error("expected the session of another user to be kept")
+			}
+
+			s, _ = store.New(requestWith(other), sessionName)
+			s.Options.MaxAge = -1
+			if err := store.Save(requestWith(other), httptest.NewRecorder(), s); err != nil {
+				t.Fatal(err)
+			}
+			if members, _ := mr.Members(name + ":tag:user:7"); len(members) != 0 {
+				t.Errorf("expected a deleted session to leave its tag sets, got %v", members)
+			}
+		})
+	}
+}
+
+func TestTagKeyFunc(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	if err := store.SetKeyFunc(func(id string) string { return "{tenant}:" + id }); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	store.Tag(session, "beta")
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("{tenant}:tag:beta") || mr.Exists("tag:beta") {
+		t.Errorf("expected the tag set under the key built by KeyFunc, got keys %v", mr.Keys())
+	}
+	if err := store.InvalidateTag(context.Background(), "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected the session and tag set to be deleted, got %v", keys)
+	}
+}
@@ -0,0 +1,228 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// createdKey is the session value recording when a session was created,
+// kept in redis when an absolute max age or session metadata is set. It is
+// removed from the values returned by New by expired, like the other values
+// added by stamp except schemaKey, which schemaVersion removes.
+const createdKey = "redisstore.created"
+
+// stampedKeys are the session values added by stamp while a session is
+// serialized, hidden from the values of sessions in memory.
+var stampedKeys = []string{createdKey, lastAccessKey, fingerprintKey, schemaKey}
+
+// Clock tells the time to a store, for the creation and age of sessions.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the default Clock, using time.Now.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock sets the clock of the store. A nil clock restores the real one.
+// TTLs are computed by redis itself, so a fake clock is mostly useful along
+// with a fake redis whose time can be changed too, e.g. miniredis.
+func (rs *RedisStore) SetClock(c Clock) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if c == nil {
+		c = realClock{}
+	}
+	rs.clock = c
+}
+
+// now returns the time of the store clock.
+func (rs *RedisStore) now() time.Time {
+	return rs.clock.Now()
+}
+
+// SetIdleTimeout sets the redis TTL of sessions to d, refreshed every time a
+// session is loaded or saved, so sessions expire after d of inactivity. The
+// cookie keeps expiring after MaxAge. Zero restores the default of expiring
+// sessions in redis after MaxAge.
+func (rs *RedisStore) SetIdleTimeout(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.idleTimeout = d
+}
+
+// SetAbsoluteMaxAge limits the lifetime of sessions to d after their
+// creation, however often they are used. The creation time is stored with the
+// session, and the redis TTL is never extended past it. Sessions older than d
+// are deleted when loaded and come back as new. Zero means no limit.
+func (rs *RedisStore) SetAbsoluteMaxAge(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.absoluteMaxAge = d
+}
+
+// SetRenewalThreshold makes the store extend the redis TTL of unchanged
+// sessions only once less than d of it remains, instead of on every Save or
+// load, which saves writes for busy sessions. Changed sessions are always
+// written with a full TTL. Zero renews every time.
+func (rs *RedisStore) SetRenewalThreshold(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.renewal = d
+}
+
+// SetTTLJitter makes the store move the redis TTL of each saved session by a
+// random offset within plus or minus d, so sessions created together don't
+// all expire at once. The TTL never goes below a minute, or below the
+// unjittered TTL if shorter, nor past the absolute max age. Zero disables
+// jitter.
+func (rs *RedisStore) SetTTLJitter(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ttlJitter = d
+}
+
+// Lowest TTL jitter can lead to.
+const minJitteredTTL = time.Minute
+
+// jitter returns a random TTL offset within the TTL jitter.
+func (rs *RedisStore) jitter() time.Duration {
+	if rs.ttlJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(2*int64(rs.ttlJitter)+1)) - rs.ttlJitter
+}
+
+// renew extends the TTL of the session in redis, unless its remaining TTL is
+// above the renewal threshold. It reports whether the session exists.
+func (rs *RedisStore) renew(ctx context.Context, session *sessions.Session) (bool, error) {
+	key := rs.key(session.ID)
+	if t, ok := rs.client().(ttlClient); ok && rs.renewal > 0 {
+		left, err := t.TTL(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if left >= rs.renewal {
+			return true, nil
+		}
+	}
+	return rs.client().Expire(ctx, key, rs.ttl(session))
+}
+
+// ttlClient is implemented by clients able to read the TTL of a key.
+type ttlClient interface {
+	// TTL returns the remaining TTL of key, or a negative duration if key
+	// does not exist or does not expire.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// NoTTL is returned by TTL for sessions that don't expire in redis.
+const NoTTL time.Duration = -1
+
+// TTL returns the time left before the session id expires in redis, or NoTTL
+// if it does not expire. It returns ErrSessionNotFound if the session does
+// not exist.
+func (rs *RedisStore) TTL(id string) (time.Duration, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return 0, err
+	}
+	t, ok := rs.client().(ttlClient)
+	if !ok {
+		return 0, errors.New("redisstore: client does not support reading TTLs")
+	}
+	ctx, key := context.Background(), rs.key(id)
+	left, err := t.TTL(ctx, key)
+	if err != nil {
+		return 0, unavailable(err)
+	}
+	if left >= 0 {
+		return left, nil
+	}
+	// negative for missing keys and keys without TTL
+	found, err := rs.client().Exists(ctx, key)
+	if err != nil {
+		return 0, unavailable(err)
+	}
+	if !found {
+		return 0, ErrSessionNotFound
+	}
+	return NoTTL, nil
+}
+
+// stamp adds the stampedKeys values of session that are enabled to its
+// values while it is serialized, and returns a function removing them.
+func (rs *RedisStore) stamp(session *sessions.Session) func() {
+	var fingerprint string
+	if st := rs.state(session); st != nil {
+		fingerprint = st.fingerprint
+	}
+	if rs.absoluteMaxAge <= 0 && rs.SchemaVersion <= 0 && !rs.metadata && fingerprint == "" {
+		return func() {}
+	}
+	if fingerprint != "" {
+		session.Values[fingerprintKey] = fingerprint
+	}
+	if rs.absoluteMaxAge > 0 || rs.metadata {
+		session.Values[createdKey] = rs.created(session).Unix()
+	}
+	if rs.metadata {
+		session.Values[lastAccessKey] = rs.now().Unix()
+	}
+	if rs.SchemaVersion > 0 {
+		session.Values[schemaKey] = rs.SchemaVersion
+	}
+	return func() {
+		for _, k := range stampedKeys {
+			delete(session.Values, k)
+		}
+	}
+}
+
+// created returns the creation time of session, which is now for sessions
+// that don't have one yet.
+func (rs *RedisStore) created(session *sessions.Session) time.Time {
+	st := rs.state(session)
+	if st == nil {
+		return rs.now()
+	}
+	if st.created.IsZero() {
+		st.created = rs.now()
+	}
+	return st.created
+}
+
+// expired takes the creation and last access times and the fingerprint out
+// of the values of a loaded session, and deletes the session if it is past
+// its absolute max age, or only resets it for read-only requests.
+func (rs *RedisStore) expired(ctx context.Context, session *sessions.Session) (bool, error) {
+	created, lastAccess := unixTime(session.Values[createdKey]), unixTime(session.Values[lastAccessKey])
+	fingerprint, _ := session.Values[fingerprintKey].(string)
+	delete(session.Values, createdKey)
+	delete(session.Values, lastAccessKey)
+	delete(session.Values, fingerprintKey)
+	if st := rs.state(session); st != nil {
+		st.created, st.lastAccess, st.fingerprint = created, lastAccess, fingerprint
+	}
+	if rs.absoluteMaxAge <= 0 || created.IsZero() || rs.now().Before(created.Add(rs.absoluteMaxAge)) {
+		return false, nil
+	}
+	session.Values = make(map[interface{}]interface{})
+	if rs.readOnlyCtx(ctx) {
+		return true, nil
+	}
+	if err := rs.delete(ctx, session); err != nil {
+		rs.log(ctx, slog.LevelError, "redisstore: deleting expired session", "id", session.ID, "error", err)
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,253 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/sessions"
+)
+
+// fakeClock is a Clock advancing along with a miniredis server.
+type fakeClock struct {
+	now time.Time
+	mr  *miniredis.Miniredis
+}
+
+// newFakeClock sets a fake clock on store, advancing along with mr.
+func newFakeClock(store *Store, mr *miniredis.Miniredis) *fakeClock {
+	c := &fakeClock{now: time.Unix(1600000000, 0), mr: mr}
+	store.SetClock(c)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// Advance moves the clock and the TTLs of miniredis forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.mr.FastForward(d)
+}
+
+func TestExpiration(t *testing.T) {
+	created := time.Unix(1600000000, 0)
+	for _, tc := range []struct {
+		maxAge         int
+		idle, absolute time.Duration
+		age            time.Duration
+		jitter         time.Duration
+		expected       time.Duration
+	}{
+		{maxAge: 3600, expected: time.Hour},
+		{maxAge: 3600, idle: time.Minute, expected: time.Minute},
+		{maxAge: 3600, absolute: 2 * time.Hour, age: 30 * time.Minute, expected: time.Hour},
+		{maxAge: 3600, absolute: 2 * time.Hour, age: 90 * time.Minute, expected: 30 * time.Minute},
+		{maxAge: 3600, idle: time.Minute, absolute: 2 * time.Hour, age: 90 * time.Minute, expected: time.Minute},
+		{maxAge: 3600, absolute: 2 * time.Hour, age: 3 * time.Hour, expected: time.Second},
+		{maxAge: 3600, jitter: -10 * time.Minute, expected: 50 * time.Minute},
+		{maxAge: 3600, jitter: -2 * time.Hour, expected: time.Minute},
+		{maxAge: 3600, idle: 30 * time.Second, jitter: -time.Minute, expected: 30 * time.Second},
+		{maxAge: 3600, absolute: 2 * time.Hour, age: 90 * time.Minute, jitter: time.Hour, expected: 30 * time.Minute},
+	} {
+		ttl := expiration(tc.maxAge, tc.idle, tc.absolute, created, created.Add(tc.age), tc.jitter)
+		if ttl != tc.expected {
+			t.Errorf("%+v: expected TTL %v, got %v", tc, tc.expected, ttl)
+		}
+	}
+}
+
+func TestSetIdleTimeout(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetIdleTimeout(30 * time.Minute)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(session.ID); ttl != 30*time.Minute {
+		t.Errorf("expected idle timeout as TTL, got %v", ttl)
+	}
+	get := func() bool {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		s, _ := store.Get(req, sessionName)
+		return !s.IsNew
+	}
+	for i := 0; i < 4; i++ {
+		mr.FastForward(20 * time.Minute)
+		if !get() {
+			t.Fatal("expected session to be refreshed when used")
+		}
+	}
+	mr.FastForward(31 * time.Minute)
+	if get() {
+		t.Error("expected idle session to expire")
+	}
+}
+
+func TestSetAbsoluteMaxAge(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	clock := newFakeClock(store, mr)
+	store.SetIdleTimeout(30 * time.Minute)
+	store.SetAbsoluteMaxAge(time.Hour)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	get := func() *sessions.Session {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		s, err := store.Get(req, sessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	clock.Advance(20 * time.Minute)
+	s := get()
+	if s.IsNew || s.Values["key"] != ok || len(s.Values) != 1 {
+		t.Fatalf("expected session within both timeouts to load, got %v", s.Values)
+	}
+	clock.Advance(20 * time.Minute)
+	if err := store.Save(req, httptest.NewRecorder(), get()); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(session.ID); ttl != 20*time.Minute {
+		t.Errorf("expected TTL to stop at the absolute max age, got %v", ttl)
+	}
+
+	clock.now = clock.now.Add(21 * time.Minute) // redis has not expired the key yet
+	if s := get(); !s.IsNew || len(s.Values) != 0 {
+		t.Error("expected session past its absolute max age to be new")
+	}
+	if mr.Exists(session.ID) {
+		t.Error("expected session past its absolute max age to be deleted")
+	}
+}
+
+func TestSetRenewalThreshold(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	store := NewRedisStore(client, []byte("secret"))
+	clock := newFakeClock(store, mr)
+	store.RedisStore.Options.MaxAge = 3600
+	store.SetRenewalThreshold(10 * time.Minute)
+	store.SetAbsoluteMaxAge(2 * time.Hour)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	resave := func() *sessions.Session {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+		s, err := store.Get(req, sessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.IsNew {
+			if err := store.Save(req, httptest.NewRecorder(), s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+
+	clock.Advance(20 * time.Minute)
+	resave()
+	if ttl := mr.TTL(session.ID); ttl != 40*time.Minute || counts["set"] != 1 || counts["expire"] != 0 {
+		t.Errorf("expected no renewal above the threshold, got TTL %v and %v", ttl, counts)
+	}
+	clock.Advance(31 * time.Minute)
+	resave()
+	if ttl := mr.TTL(session.ID); ttl != time.Hour || counts["set"] != 1 || counts["expire"] != 1 {
+		t.Errorf("expected renewal below the threshold, got TTL %v and %v", ttl, counts)
+	}
+
+	clock.Advance(55 * time.Minute)
+	resave()
+	if ttl := mr.TTL(session.ID); ttl != 14*time.Minute {
+		t.Errorf("expected renewal to stop at the absolute max age, got TTL %v", ttl)
+	}
+	clock.Advance(15 * time.Minute)
+	if s := resave(); !s.IsNew {
+		t.Error("expected session past its absolute max age to be new")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			mr.FlushAll()
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetKeyPrefix("session:")
+			store.SetMaxAge(100)
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(req, sessionName)
+			if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+				t.Fatal(err)
+			}
+			if ttl, err := store.TTL(session.ID); err != nil || ttl != 100*time.Second {
+				t.Errorf("expected a 100s TTL, got %v, %v", ttl, err)
+			}
+			if found, err := store.ExistsByID(session.ID); err != nil || !found {
+				t.Errorf("expected the session to exist, got %v, %v", found, err)
+			}
+
+			v, _ := mr.Get("session:" + session.ID)
+			mr.Set("session:"+session.ID, v) // without TTL
+			if ttl, err := store.TTL(session.ID); err != nil || ttl != NoTTL {
+				t.Errorf("expected NoTTL, got %v, %v", ttl, err)
+			}
+
+			if _, err := store.TTL("missing"); err != ErrSessionNotFound {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+			if found, err := store.ExistsByID("missing"); err != nil || found {
+				t.Errorf("expected the missing session not to exist, got %v, %v", found, err)
+			}
+		})
+	}
+}
+
+func TestSetTTLJitter(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.RedisStore.Options.MaxAge = 3600
+	store.SetTTLJitter(10 * time.Minute)
+
+	ttls := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+		ttl := mr.TTL(session.ID)
+		if ttl < 50*time.Minute || ttl > 70*time.Minute {
+			t.Errorf("expected TTL within 10m of 1h, got %v", ttl)
+		}
+		ttls[ttl] = true
+	}
+	if len(ttls) < 10 {
+		t.Errorf("expected TTLs to be spread, got %d distinct values", len(ttls))
+	}
+}
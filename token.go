@@ -0,0 +1,75 @@
+package redisstore
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// Scheme of session tokens sent in the Authorization header.
+const bearer = "Bearer "
+
+// SetTokenMode makes the store carry the signed session ID in the header
+// instead of a cookie, for clients that can't handle cookies. With
+// Authorization, requests send "Bearer <token>" and Save writes the same
+// back; other headers, e.g. X-Session-Token, carry the bare token. Deleting a
+// session sends an empty token. Sessions are stored in redis the same way in
+// both modes, so a store in token mode and one in cookie mode can share them.
+// Only one session name can be used per request in token mode. An empty
+// header restores the default cookie mode.
+func (rs *RedisStore) SetTokenMode(header string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.tokenHeader = http.CanonicalHeaderKey(header)
+}
+
+// readID returns the encoded session ID sent with r for the session name,
+// or "" if there is none.
+func (rs *RedisStore) readID(r *http.Request, name string) string {
+	if rs.tokenHeader == "" {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+	v := r.Header.Get(rs.tokenHeader)
+	if rs.tokenHeader == "Authorization" {
+		if len(v) < len(bearer) || !strings.EqualFold(v[:len(bearer)], bearer) {
+			return ""
+		}
+		v = strings.TrimSpace(v[len(bearer):])
+	}
+	return v
+}
+
+// requestID returns the session ID sent with r for the session name, or ""
+// if there is none or its signature is invalid.
+func (rs *RedisStore) requestID(r *http.Request, name string) string {
+	value := rs.readID(r, name)
+	if value == "" {
+		return ""
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, value, &id, rs.Codecs...); err != nil {
+		rs.log(r.Context(), slog.LevelDebug, "redisstore: invalid session cookie", "name", name, "error", err)
+		return ""
+	}
+	return id
+}
+
+// writeID sends encoded, the encoded ID of session, to the client in a
+// cookie or a header. An empty value clears it.
+func (rs *RedisStore) writeID(w http.ResponseWriter, session *sessions.Session, encoded string) {
+	if rs.tokenHeader == "" {
+		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		return
+	}
+	if rs.tokenHeader == "Authorization" && encoded != "" {
+		encoded = bearer + encoded
+	}
+	w.Header().Set(rs.tokenHeader, encoded)
+}
@@ -0,0 +1,179 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+)
+
+// sessionRouter returns a router setting the session value key from the
+// query on /set and writing it back on /get.
+func sessionRouter(store sessions.Store) *gin.Engine {
+	r := gin.New()
+	r.Use(sessions.Sessions(sessionName, store))
+	r.GET("/set", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("key", c.Query("v"))
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/get", func(c *gin.Context) {
+		v, _ := sessions.Default(c).Get("key").(string)
+		c.String(http.StatusOK, v)
+	})
+	r.GET("/delete", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Options(sessions.Options{MaxAge: -1})
+		session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	return r
+}
+
+func serve(r http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r.ServeHTTP(res, req)
+	return res
+}
+
+func TestTokenMode(t *testing.T) {
+	_, client := newMiniRedis(t)
+	web := NewRedisStore(client, []byte("secret"))
+	api := NewRedisStore(client, []byte("secret"))
+	api.SetTokenMode("X-Session-Token")
+	webRouter, apiRouter := sessionRouter(web), sessionRouter(api)
+
+	// logged in on the web, used from the API
+	res := serve(webRouter, "/set?v=web", nil)
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a cookie, got %v", res.Header())
+	}
+	token := cookies[0].Value
+	res = serve(apiRouter, "/get", http.Header{"X-Session-Token": {token}})
+	if res.Body.String() != "web" {
+		t.Errorf("expected the web session from the token, got %q", res.Body.String())
+	}
+
+	// logged in from the API, used on the web
+	res = serve(apiRouter, "/set?v=api", nil)
+	if res.Header().Get("Set-Cookie") != "" {
+		t.Errorf("expected no cookie in token mode, got %q", res.Header().Get("Set-Cookie"))
+	}
+	token = res.Header().Get("X-Session-Token")
+	if token == "" {
+		t.Fatal("expected a token header")
+	}
+	res = serve(webRouter, "/get", http.Header{"Cookie": {sessionName + "=" + token}})
+	if res.Body.String() != "api" {
+		t.Errorf("expected the API session from the cookie, got %q", res.Body.String())
+	}
+
+	res = serve(apiRouter, "/delete", http.Header{"X-Session-Token": {token}})
+	if v, ok := res.Header()["X-Session-Token"]; !ok || v[0] != "" {
+		t.Errorf("expected an empty token on delete, got %v", v)
+	}
+	res = serve(apiRouter, "/get", http.Header{"X-Session-Token": {token}})
+	if res.Body.String() != "" {
+		t.Errorf("expected the session to be deleted, got %q", res.Body.String())
+	}
+}
+
+func TestTokenModeBearer(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetTokenMode("authorization")
+	r := sessionRouter(store)
+
+	res := serve(r, "/set?v=bearer", nil)
+	auth := res.Header().Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		t.Fatalf("expected a bearer token, got %q", auth)
+	}
+	res = serve(r, "/get", http.Header{"Authorization": {auth}})
+	if res.Body.String() != "bearer" {
+		t.Errorf("expected the session from the bearer token, got %q", res.Body.String())
+	}
+	res = serve(r, "/get", http.Header{"Authorization": {strings.TrimPrefix(auth, "Bearer ")}})
+	if res.Body.String() != "" {
+		t.Errorf("expected tokens without the Bearer scheme to be ignored, got %q", res.Body.String())
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", auth)
+	if found, err := store.Exists(req, sessionName); err != nil || !found {
+		t.Errorf("expected Exists to find the session from the token, got %v, %v", found, err)
+	}
+}
+
+func TestTokenModeEncoding(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetTokenMode("X-Session-Token")
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Result().Cookies()) != 0 {
+		t.Errorf("expected no cookies, got %v", res.Result().Cookies())
+	}
+	token := res.Header().Get("X-Session-Token")
+	var id string
+	if err := securecookie.DecodeMulti(sessionName, token, &id, store.Codecs...); err != nil || id != session.ID {
+		t.Errorf("expected the token to be the signed session ID, got %q (%v)", id, err)
+	}
+
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("X-Session-Token", token+"x")
+	if s, _ := store.Get(req2, sessionName); !s.IsNew {
+		t.Error("expected a tampered token to be rejected")
+	}
+	req3, _ := http.NewRequest("GET", "/", nil)
+	req3.Header.Set("X-Session-Token", token)
+	if s, err := store.Get(req3, sessionName); err != nil || s.Values["key"] != ok {
+		t.Errorf("expected the session from the token, got %v", err)
+	}
+}
+
+func TestSaveToken(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	token, err := store.SaveToken(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := securecookie.DecodeMulti(sessionName, token, &id, store.Codecs...); err != nil || id != session.ID {
+		t.Fatalf("expected the token to decode to the session ID, got %q (%v)", id, err)
+	}
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.AddCookie(&http.Cookie{Name: sessionName, Value: token})
+	if s, err := store.Get(req2, sessionName); err != nil || s.IsNew || s.Values["key"] != ok {
+		t.Errorf("expected the stored session from the token, got %v", err)
+	}
+
+	session.Options.MaxAge = -1
+	if token, err := store.SaveToken(session); err != nil || token != "" {
+		t.Errorf("expected an empty token on delete, got %q, %v", token, err)
+	}
+	if mr.Exists(session.ID) {
+		t.Error("expected the session to be deleted")
+	}
+}
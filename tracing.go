@@ -0,0 +1,60 @@
+package redisstore
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the OpenTelemetry tracer of the store.
+const tracerName = "github.com/zcxzcxczcx/redisstore"
+
+// SetTracerProvider sets the provider of the spans of the store. By default,
+// or if tp is nil, spans come from the provider of the span in the request
+// context if there is one, or from the global provider, which does nothing
+// unless one is configured.
+func (rs *RedisStore) SetTracerProvider(tp trace.TracerProvider) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.tracerProvider = tp
+}
+
+// startSpan starts a span named name around a redis operation of the store,
+// with the tracer of the provider described by SetTracerProvider.
+func (rs *RedisStore) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	tp := rs.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+		if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+			tp = parent.TracerProvider()
+		}
+	}
+	return tp.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("redisstore.key_prefix", rs.keyPrefix)))
+}
+
+// endSpan ends span, recording err if not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanSize records the size of the payload read or written on the span of
+// ctx, and for the metrics of the operation of ctx if measured.
+func spanSize(ctx context.Context, size int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("redisstore.size", size))
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		op.size = size
+	}
+}
+
+// spanHit records on span whether a loaded session was found.
+func spanHit(span trace.Span, found bool) {
+	span.SetAttributes(attribute.Bool("redisstore.hit", found))
+}
@@ -0,0 +1,116 @@
+package redisstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	_, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetKeyPrefix("session:")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values["key"] = ok
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	req2, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	session, err := store.Get(req2, sessionName)
+	if err != nil || session.IsNew {
+		t.Fatalf("expected the saved session, got %v", err)
+	}
+	session.Options.MaxAge = -1
+	if err := store.Save(req2, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "request" {
+			continue
+		}
+		names = append(names, span.Name)
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("expected %s to be a child of the request span", span.Name)
+		}
+		attrs := make(map[string]interface{})
+		for _, kv := range span.Attributes {
+			attrs[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		if attrs["redisstore.key_prefix"] != "session:" {
+			t.Errorf("%s: expected key prefix attribute, got %v", span.Name, attrs)
+		}
+		if size, ok := attrs["redisstore.size"].(int64); span.Name != "redisstore.delete" && (!ok || size <= 0) {
+			t.Errorf("%s: expected size attribute, got %v", span.Name, attrs)
+		}
+		if span.Name == "redisstore.load" && attrs["redisstore.hit"] != true {
+			t.Errorf("expected the load to be a hit, got %v", attrs)
+		}
+	}
+	want := []string{"redisstore.save", "redisstore.load", "redisstore.delete"}
+	if len(names) != len(want) {
+		t.Fatalf("expected spans %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("expected spans %v, got %v", want, names)
+			break
+		}
+	}
+}
+
+func TestSetTracerProvider(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	store.SetTracerProvider(tp)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := store.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del(session.ID)
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+	store.Get(req2, sessionName)
+	mr.Close()
+	store.New(req2, sessionName)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected spans without a parent from the provider, got %d", len(spans))
+	}
+	for i, span := range spans[1:] {
+		hit := true
+		for _, kv := range span.Attributes {
+			if kv.Key == "redisstore.hit" {
+				hit = kv.Value.AsBool()
+			}
+		}
+		if span.Name != "redisstore.load" || hit {
+			t.Errorf("expected a missed load, got %s with %v", span.Name, span.Attributes)
+		}
+		if failed := span.Status.Code == codes.Error; failed != (i == 1) {
+			t.Errorf("expected only the load without redis to fail, got %v", span.Status)
+		}
+	}
+}
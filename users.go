@@ -0,0 +1,254 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// DefaultUserIDKey is the usual session value holding the ID of the user a
+// session belongs to, for SetUserIDKey.
+const DefaultUserIDKey = "uid"
+
+// EvictionPolicy is what happens when a user logs in with more sessions
+// than allowed by SetMaxSessionsPerUser.
+type EvictionPolicy int
+
+const (
+	// EvictOldest deletes the oldest sessions of the user.
+	EvictOldest EvictionPolicy = iota
+	// RejectNewLogin makes Save return ErrTooManySessions.
+	RejectNewLogin
+)
+
+// Script adding a member to a sorted set unless it is already there, and
+// extending the TTL of the set to at least ARGV[3] milliseconds.
+const zaddNXScript = `redis.call("ZADD", KEYS[1], "NX", ARGV[2], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+return 1`
+
+// indexClient is implemented by clients supporting the user index, a sorted
+// set of session IDs scored by the time they were bound to the user.
+type indexClient interface {
+	// ZAddNX adds member to the sorted set key with score, unless it is
+	// already there, and extends the TTL of key to at least ttl.
+	ZAddNX(ctx context.Context, key, member string, score int64, ttl time.Duration) error
+	// ZRem removes members from the sorted set key.
+	ZRem(ctx context.Context, key string, members ...string) error
+	// ZRange returns the members of the sorted set key, lowest score first.
+	ZRange(ctx context.Context, key string) ([]string, error)
+}
+
+// SetUserIDKey enables the user index with key, e.g. DefaultUserIDKey, the
+// session value holding the user ID of a session. Sessions with a non-empty
+// string under that key are indexed by user when saved, which
+// SessionsForUser and DeleteAllForUser rely on. The index is disabled by
+// default, and by an empty key.
+func (rs *RedisStore) SetUserIDKey(key string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.userKey = key
+}
+
+// BindUser marks session as belonging to userID. The index is updated by
+// the next Save.
+func (rs *RedisStore) BindUser(session *sessions.Session, userID string) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if rs.userKey == "" {
+		return errors.New("redisstore: user index is disabled")
+	}
+	session.Values[rs.userKey] = userID
+	return nil
+}
+
+// SetMaxSessionsPerUser limits the number of sessions of a user to n, with
+// policy deciding what happens when a new session is saved beyond the limit.
+// Zero or less means no limit.
+func (rs *RedisStore) SetMaxSessionsPerUser(n int, policy EvictionPolicy) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.maxUserSessions, rs.eviction = n, policy
+}
+
+// SessionsForUser returns the IDs of the live sessions of userID, oldest
+// first. Index entries of expired sessions are removed, unless the store is
+// read-only.
+func (rs *RedisStore) SessionsForUser(userID string) ([]string, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	return rs.liveSessions(context.Background(), userID)
+}
+
+// liveSessions returns the IDs of the live sessions of userID, oldest first,
+// removing the index entries of expired sessions.
+func (rs *RedisStore) liveSessions(ctx context.Context, userID string) ([]string, error) {
+	s, err := rs.indexes()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.ZRange(ctx, rs.userIndex(userID))
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	var live, dead []string
+	for _, id := range ids {
+		found, err := rs.client().Exists(ctx, rs.key(id))
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		if found {
+			live = append(live, id)
+		} else {
+			dead = append(dead, id)
+		}
+	}
+	if len(dead) > 0 && !rs.readOnlyCtx(ctx) {
+		if err := s.ZRem(ctx, rs.userIndex(userID), dead...); err != nil {
+			return nil, unavailable(err)
+		}
+	}
+	return live, nil
+}
+
+// DeleteAllForUser deletes every session of userID, logging the user out
+// of all devices.
+func (rs *RedisStore) DeleteAllForUser(userID string) error {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if err := rs.open(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := rs.writable(ctx); err != nil {
+		return err
+	}
+	s, err := rs.indexes()
+	if err != nil {
+		return err
+	}
+	ids, err := s.ZRange(ctx, rs.userIndex(userID))
+	if err != nil {
+		return unavailable(err)
+	}
+	// one key at a time, keys of a cluster may live on different nodes
+	for _, id := range ids {
+		if _, err := rs.client().Del(ctx, rs.key(id)); err != nil {
+			return unavailable(err)
+		}
+		rs.invalidate(ctx, rs.key(id))
+		rs.observe().OnDelete(id)
+	}
+	_, err = rs.client().Del(ctx, rs.userIndex(userID))
+	return unavailable(err)
+}
+
+// indexes returns the client of the store as an indexClient.
+func (rs *RedisStore) indexes() (indexClient, error) {
+	s, ok := rs.client().(indexClient)
+	if !ok {
+		return nil, errors.New("redisstore: client does not support the user index")
+	}
+	return s, nil
+}
+
+// userIndex returns the key of the index of session IDs of userID, built
+// like session keys so that a KeyFunc applies to it too. Session IDs never
+// contain colons, so it can't be the key of a session.
+func (rs *RedisStore) userIndex(userID string) string {
+	return rs.key("user:" + userID)
+}
+
+// userID returns the user session is bound to, or "" if none.
+func (rs *RedisStore) userID(session *sessions.Session) string {
+	if rs.userKey == "" {
+		return ""
+	}
+	id, _ := session.Values[rs.userKey].(string)
+	return id
+}
+
+// admit checks that session can be saved under the session limit of its
+// user. It only fails with the RejectNewLogin policy.
+func (rs *RedisStore) admit(ctx context.Context, session *sessions.Session) error {
+	userID := rs.userID(session)
+	if userID == "" || rs.maxUserSessions <= 0 || rs.eviction != RejectNewLogin {
+		return nil
+	}
+	ids, err := rs.liveSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == session.ID {
+			return nil // already counted
+		}
+	}
+	if len(ids) >= rs.maxUserSessions {
+		return &ErrTooManySessions{UserID: userID, Limit: rs.maxUserSessions}
+	}
+	return nil
+}
+
+// index adds the saved session to the index of its user, if any, and evicts
+// the oldest sessions of the user beyond the limit.
+func (rs *RedisStore) index(ctx context.Context, session *sessions.Session) error {
+	userID := rs.userID(session)
+	if userID == "" {
+		return nil
+	}
+	s, err := rs.indexes()
+	if err != nil {
+		return err
+	}
+	key := rs.userIndex(userID)
+	if err := s.ZAddNX(ctx, key, session.ID, rs.now().UnixNano(), rs.ttl(session)); err != nil {
+		return unavailable(err)
+	}
+	if rs.maxUserSessions <= 0 || rs.eviction != EvictOldest {
+		return nil
+	}
+	ids, err := rs.liveSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	excess := len(ids) - rs.maxUserSessions
+	for _, id := range ids {
+		if excess <= 0 {
+			break
+		}
+		if id == session.ID {
+			continue
+		}
+		if _, err := rs.client().Del(ctx, rs.key(id)); err != nil {
+			return unavailable(err)
+		}
+		rs.invalidate(ctx, rs.key(id))
+		if err := s.ZRem(ctx, key, id); err != nil {
+			return unavailable(err)
+		}
+		rs.observe().OnDelete(id)
+		excess--
+	}
+	return nil
+}
+
+// unindex removes the session id from the index of the user of session.
+func (rs *RedisStore) unindex(ctx context.Context, session *sessions.Session, id string) error {
+	userID := rs.userID(session)
+	if userID == "" {
+		return nil
+	}
+	s, err := rs.indexes()
+	if err != nil {
+		return err
+	}
+	return unavailable(s.ZRem(ctx, rs.userIndex(userID), id))
+}
@@ -0,0 +1,210 @@
+package redisstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDeleteAllForUser(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetUserIDKey(DefaultUserIDKey)
+			var (
+				ids     []string
+				cookies []string
+			)
+			for i := 0; i < 3; i++ {
+				req, _ := http.NewRequest("GET", "/", nil)
+				session, _ := store.Get(req, sessionName)
+				if i == 0 {
+					session.Values[DefaultUserIDKey] = name
+				} else if err := store.BindUser(session, name); err != nil {
+					t.Fatal(err)
+				}
+				res := httptest.NewRecorder()
+				if err := store.Save(req, res, session); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, session.ID)
+				cookies = append(cookies, res.Header().Get("Set-Cookie"))
+			}
+			if ttl := mr.TTL("user:" + name); ttl != time.Duration(sessionExpire)*time.Second {
+				t.Errorf("expected the index to expire with the sessions, got %v", ttl)
+			}
+
+			found, err := store.SessionsForUser(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(ids)
+			sort.Strings(found)
+			if len(found) != 3 || found[0] != ids[0] || found[1] != ids[1] || found[2] != ids[2] {
+				t.Errorf("expected sessions %v, got %v", ids, found)
+			}
+
+			if err := store.DeleteAllForUser(name); err != nil {
+				t.Fatal(err)
+			}
+			for _, cookie := range cookies {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.Header.Set("Cookie", cookie)
+				if s, _ := store.Get(req, sessionName); !s.IsNew {
+					t.Error("expected session to be revoked")
+				}
+			}
+			if mr.Exists("user:" + name) {
+				t.Error("expected the index to be deleted")
+			}
+		})
+	}
+}
+
+func TestSessionsForUserCleanup(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetUserIDKey(DefaultUserIDKey)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		session, _ := store.Get(req, sessionName)
+		store.BindUser(session, "alice")
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, session.ID)
+	}
+	mr.Del(ids[0])
+
+	found, err := store.SessionsForUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0] != ids[1] {
+		t.Errorf("expected only the live session, got %v", found)
+	}
+	if members, _ := mr.ZMembers("user:alice"); len(members) != 1 {
+		t.Errorf("expected the expired session to be removed from the index, got %v", members)
+	}
+
+	store.SetUserIDKey("")
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	if err := store.BindUser(session, "alice"); err == nil {
+		t.Error("expected error when the user index is disabled")
+	}
+}
+
+func TestSetMaxSessionsPerUser(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictOldest, RejectNewLogin} {
+		_, client := newMiniRedis(t)
+		store := NewRedisStore(client, []byte("secret"))
+		store.SetUserIDKey(DefaultUserIDKey)
+		store.SetMaxSessionsPerUser(2, policy)
+
+		var (
+			cookies []string
+			errs    []error
+		)
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(req, sessionName)
+			store.BindUser(session, "alice")
+			res := httptest.NewRecorder()
+			errs = append(errs, store.Save(req, res, session))
+			cookies = append(cookies, res.Header().Get("Set-Cookie"))
+		}
+		alive := func(cookie string) bool {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Cookie", cookie)
+			s, _ := store.Get(req, sessionName)
+			return !s.IsNew
+		}
+
+		switch policy {
+		case EvictOldest:
+			if errs[2] != nil {
+				t.Fatal(errs[2])
+			}
+			if alive(cookies[0]) || !alive(cookies[1]) || !alive(cookies[2]) {
+				t.Error("expected the oldest session to be evicted")
+			}
+		case RejectNewLogin:
+			var tooMany *ErrTooManySessions
+			if !errors.As(errs[2], &tooMany) || tooMany.UserID != "alice" || tooMany.Limit != 2 {
+				t.Fatalf("expected ErrTooManySessions, got %v", errs[2])
+			}
+			if !alive(cookies[0]) || !alive(cookies[1]) || cookies[2] != "" {
+				t.Error("expected the new session to be rejected")
+			}
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Cookie", cookies[0])
+			session, _ := store.Get(req, sessionName)
+			session.Values["key"] = ok
+			if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+				t.Errorf("expected existing sessions to be saved, got %v", err)
+			}
+		}
+		if ids, _ := store.SessionsForUser("alice"); len(ids) != 2 {
+			t.Errorf("expected 2 sessions for user, got %v", ids)
+		}
+	}
+}
+
+func TestUserIndexOptIn(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	counts := countCommands(client)
+	// countingClient hides the optional methods, the user index included
+	store := NewRedisStoreWithClient(&countingClient{Client: NewGoRedisV9Client(client)}, []byte("secret"))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, sessionName)
+	session.Values[DefaultUserIDKey] = "alice"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("expected the session to be saved without the index, got %v", err)
+	}
+	if counts["evalsha"]+counts["eval"] != 0 || mr.Exists("user:alice") {
+		t.Errorf("expected no user index by default, got %v", counts)
+	}
+
+	store.Close()
+	if _, err := store.SessionsForUser("alice"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from SessionsForUser, got %v", err)
+	}
+	if err := store.DeleteAllForUser("alice"); err != ErrStoreClosed {
+		t.Errorf("expected ErrStoreClosed from DeleteAllForUser, got %v", err)
+	}
+}
+
+func TestUserIndexKeyFunc(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	store := NewRedisStore(client, []byte("secret"))
+	store.SetUserIDKey(DefaultUserIDKey)
+	if err := store.SetKeyFunc(func(id string) string { return "{tenant}:" + id }); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, sessionName)
+	session.Values[DefaultUserIDKey] = "alice"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("{tenant}:user:alice") || mr.Exists("user:alice") {
+		t.Errorf("expected the index under the key built by KeyFunc, got keys %v", mr.Keys())
+	}
+	if ids, err := store.SessionsForUser("alice"); err != nil || len(ids) != 1 || ids[0] != session.ID {
+		t.Errorf("expected session %s, got %v %v", session.ID, ids, err)
+	}
+	if err := store.DeleteAllForUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected the sessions and index to be deleted, got %v", keys)
+	}
+}
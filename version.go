@@ -0,0 +1,101 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// ErrSessionConflict is returned by Save when version checks are enabled and
+// the session was written by someone else since it was loaded. Callers retry
+// by loading the session again, applying their changes and saving it.
+var ErrSessionConflict = errors.New("redisstore: session was modified concurrently")
+
+// Size of the version stored in front of session data.
+const versionSize = 8
+
+// Script setting KEYS[1] to ARGV[1] with a TTL of ARGV[3] milliseconds, if
+// the stored value starts with the version ARGV[2], or if it does not exist.
+// An empty version requires the key not to exist.
+const setIfVersionScript = `local cur = redis.call("GET", KEYS[1])
+if cur and (ARGV[2] == "" or string.sub(cur, 1, #ARGV[2]) ~= ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1`
+
+// versionClient is implemented by clients supporting version checks.
+type versionClient interface {
+	// SetIfVersion atomically sets key to value, expiring after ttl if ttl
+	// is positive, if the value of key starts with version or if key does
+	// not exist. An empty version requires key not to exist. It reports
+	// whether key was set.
+	SetIfVersion(ctx context.Context, key string, value []byte, ttl time.Duration, version []byte) (bool, error)
+}
+
+// SetVersionCheck enables version checks, preventing lost updates when
+// concurrent requests save the same session. Stored sessions then carry a
+// version, checked and incremented atomically by a script, and Save returns
+// ErrSessionConflict if the session changed since it was loaded. Sessions
+// stored before the setting was toggled can't be read afterwards. Version
+// checks don't apply to HashMode.
+func (rs *RedisStore) SetVersionCheck(enabled bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.versionCheck = enabled
+}
+
+// versioned reports whether the stored sessions carry a version.
+func (rs *RedisStore) versioned() bool {
+	return rs.versionCheck && rs.storage != HashMode
+}
+
+// unversion splits data read from redis into its version and the session
+// data, keeping the version in the state of session.
+func (rs *RedisStore) unversion(session *sessions.Session, data []byte) ([]byte, error) {
+	if len(data) < versionSize {
+		return nil, errors.New("redisstore: missing session version")
+	}
+	if st := rs.state(session); st != nil {
+		st.version = data[:versionSize:versionSize] // data may be shared with other loads
+	}
+	return data[versionSize:], nil
+}
+
+// setVersioned writes b, the encoded session, with the version following the
+// loaded one if the stored version did not change since.
+func (rs *RedisStore) setVersioned(ctx context.Context, session *sessions.Session, b []byte) error {
+	v, ok := rs.client().(versionClient)
+	if !ok {
+		return errors.New("redisstore: client does not support version checks")
+	}
+	var loaded []byte
+	st := rs.state(session)
+	if st != nil && st.id == session.ID {
+		loaded = st.version
+	}
+	next := make([]byte, versionSize, versionSize+len(b))
+	if loaded != nil {
+		binary.BigEndian.PutUint64(next, binary.BigEndian.Uint64(loaded)+1)
+	}
+	set, err := v.SetIfVersion(ctx, rs.key(session.ID), append(next, b...), rs.ttl(session), loaded)
+	if err != nil {
+		return unavailable(err)
+	}
+	if !set {
+		// a cached copy is stale, the caller reloads the session to retry
+		rs.cache.remove(rs.key(session.ID))
+		return ErrSessionConflict
+	}
+	if st != nil {
+		st.version = next
+	}
+	return nil
+}
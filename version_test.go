@@ -0,0 +1,140 @@
+package redisstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSetVersionCheck(t *testing.T) {
+	mr, _ := newMiniRedis(t)
+	for name, c := range clients(t, mr) {
+		t.Run(name, func(t *testing.T) {
+			store := NewRedisStoreWithClient(c, []byte("secret"))
+			store.SetVersionCheck(true)
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(req, sessionName)
+			session.Values["key"] = "first"
+			res := httptest.NewRecorder()
+			if err := store.Save(req, res, session); err != nil {
+				t.Fatal(err)
+			}
+			get := func() *sessions.Session {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.Header.Set("Cookie", res.Header().Get("Set-Cookie"))
+				s, err := store.Get(req, sessionName)
+				if err != nil || s.IsNew {
+					t.Fatalf("expected session to load, got %v", err)
+				}
+				return s
+			}
+
+			a, b := get(), get()
+			a.Values["key"] = "a"
+			if err := store.Save(req, httptest.NewRecorder(), a); err != nil {
+				t.Fatal(err)
+			}
+			b.Values["key"] = "b"
+			if err := store.Save(req, httptest.NewRecorder(), b); !errors.Is(err, ErrSessionConflict) {
+				t.Fatalf("expected ErrSessionConflict, got %v", err)
+			}
+			if s := get(); s.Values["key"] != "a" {
+				t.Errorf("expected the first save to win, got %v", s.Values["key"])
+			}
+			a.Values["key"] = "a2"
+			if err := store.Save(req, httptest.NewRecorder(), a); err != nil {
+				t.Errorf("expected consecutive saves to succeed, got %v", err)
+			}
+
+			loaded := make([]*sessions.Session, 5)
+			for i := range loaded {
+				loaded[i] = get()
+				loaded[i].Values["key"] = i
+			}
+			var (
+				wg        sync.WaitGroup
+				mu        sync.Mutex
+				conflicts int
+			)
+			for _, s := range loaded {
+				wg.Add(1)
+				go func(s *sessions.Session) {
+					defer wg.Done()
+					err := store.Save(req, httptest.NewRecorder(), s)
+					mu.Lock()
+					defer mu.Unlock()
+					if errors.Is(err, ErrSessionConflict) {
+						conflicts++
+					} else if err != nil {
+						t.Error(err)
+					}
+				}(s)
+			}
+			wg.Wait()
+			if conflicts != len(loaded)-1 {
+				t.Errorf("expected all but one concurrent save to conflict, got %d conflicts", conflicts)
+			}
+
+			s := get()
+			res2 := httptest.NewRecorder()
+			if err := store.RegenerateID(req, res2, s); err != nil {
+				t.Fatal(err)
+			}
+			res = res2
+			s2 := get()
+			s2.Values["key"] = "regenerated"
+			if err := store.Save(req, httptest.NewRecorder(), s2); err != nil {
+				t.Errorf("expected save after RegenerateID to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVersionCheckLocalCache(t *testing.T) {
+	_, client := newMiniRedis(t)
+	cached := NewRedisStore(client, []byte("secret"))
+	cached.SetVersionCheck(true)
+	cached.SetLocalCache(10, time.Minute)
+	other := NewRedisStore(client, []byte("secret"))
+	other.SetVersionCheck(true)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	session, _ := cached.New(req, sessionName)
+	res := httptest.NewRecorder()
+	if err := cached.Save(req, res, session); err != nil {
+		t.Fatal(err)
+	}
+	load := func(store *Store) *sessions.Session {
+		s, err := store.New(requestWith(res), sessionName)
+		if err != nil || s.IsNew {
+			t.Fatalf("expected session to load, got %v", err)
+		}
+		return s
+	}
+	load(cached) // cached with its first version
+
+	s := load(other)
+	s.Values["other"] = ok
+	if err := other.Save(req, httptest.NewRecorder(), s); err != nil {
+		t.Fatal(err)
+	}
+	s = load(cached)
+	s.Values["cached"] = ok
+	if err := cached.Save(req, httptest.NewRecorder(), s); !errors.Is(err, ErrSessionConflict) {
+		t.Fatalf("expected ErrSessionConflict for a stale cached session, got %v", err)
+	}
+	s = load(cached)
+	s.Values["cached"] = ok
+	if err := cached.Save(req, httptest.NewRecorder(), s); err != nil {
+		t.Fatalf("expected the retry to load the session from redis, got %v", err)
+	}
+	if s := load(other); s.Values["other"] != ok || s.Values["cached"] != ok {
+		t.Errorf("expected both changes to be kept, got %v", s.Values)
+	}
+}